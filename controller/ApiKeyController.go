@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApiKeyController struct {
+	apiKeyService impl.ApiKeyImpl
+}
+
+func NewApiKeyController() *ApiKeyController {
+	return &ApiKeyController{
+		apiKeyService: impl.ApiKey,
+	}
+}
+
+// GetApiKeys 获取当前用户的全部API密钥
+func (ac *ApiKeyController) GetApiKeys(c *gin.Context) {
+	userID := c.MustGet("user_id").(int64)
+
+	apiKeys, err := ac.apiKeyService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+// CreateApiKey 创建API密钥，完整密钥只在创建时返回一次
+func (ac *ApiKeyController) CreateApiKey(c *gin.Context) {
+	var createApiKeyDto dto.CreateApiKeyDto
+	if err := c.ShouldBindJSON(&createApiKeyDto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(int64)
+
+	created, err := ac.apiKeyService.Create(userID, createApiKeyDto)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// DeleteApiKey 吊销当前用户的API密钥
+func (ac *ApiKeyController) DeleteApiKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid api key id"})
+		return
+	}
+	userID := c.MustGet("user_id").(int64)
+
+	if err := ac.apiKeyService.Delete(userID, id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Api key revoked"})
+}
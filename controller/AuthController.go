@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strings"
 	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/authProvider"
 	"tiny-admin-api-serve/impl"
 	"tiny-admin-api-serve/middleware"
-	"tiny-admin-api-serve/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,39 +33,280 @@ func (a *AuthController) Login(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"msg": err.Error()})
 		return
 	}
+	// 账户或IP因多次登录失败被锁定时直接拒绝
+	clientIP := c.ClientIP()
+	if ttl, locked := impl.LoginLock.Check(loginBody.Email, clientIP); locked {
+		c.JSON(http.StatusOK, gin.H{"msg": fmt.Sprintf("登录失败次数过多，请%d分钟后再试", int(math.Ceil(ttl.Minutes())))})
+		return
+	}
+	// 按配置选择本地账户或LDAP认证
+	user, err := impl.Authenticators.Authenticate(loginBody.Email, loginBody.Password)
+	if err != nil {
+		if errors.Is(err, impl.ErrInvalidCredentials) {
+			impl.LoginLock.RecordFailure(loginBody.Email, clientIP)
+			c.JSON(http.StatusOK, gin.H{"msg": "用户名或密码错误"})
+			return
+		}
+		// 自助注册的账户验证邮箱后才能登录
+		if errors.Is(err, impl.ErrAccountUnverified) {
+			c.JSON(http.StatusOK, gin.H{"msg": "邮箱尚未验证，请先完成邮箱验证", "emailUnverified": true})
+			return
+		}
+		if errors.Is(err, impl.ErrAccountDisabled) {
+			c.JSON(http.StatusOK, gin.H{"msg": "账户已停用"})
+			return
+		}
+		log.Printf("login of %s failed: %v", loginBody.Email, err)
+		c.JSON(http.StatusOK, gin.H{"msg": "认证服务暂时不可用，请稍后再试"})
+		return
+	}
+	impl.LoginLock.Reset(loginBody.Email)
+
+	// 已启用双因素认证时先返回短期挑战令牌，校验验证码后再签发token
+	if user.TotpEnabled {
+		challenge, err := impl.TwoFactor.CreateLoginChallenge(user.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to create login challenge"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"message":           "Two-factor authentication required",
+		})
+		return
+	}
+
+	a.issueTokens(c, user)
+}
+
+// LoginTwoFactor 登录第二步，使用挑战令牌和TOTP验证码（或恢复码）换取token
+func (a *AuthController) LoginTwoFactor(c *gin.Context) {
+	var body dto.LoginTwoFactorBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusOK, gin.H{"msg": err.Error()})
+		return
+	}
+	userID, err := impl.TwoFactor.PeekLoginChallenge(body.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"msg": err.Error()})
+		return
+	}
 	var user dto.User
-	impl.User.FindByEmail(loginBody.Email, &user)
-	if &user == nil {
+	if err := impl.User.FindById(userID, &user); err != nil {
 		c.JSON(http.StatusOK, gin.H{"msg": "用户不存在"})
 		return
 	}
-	isValid, err := utils.VerifyPassword(loginBody.Password, user.Salt, user.Password)
-	if err != nil || !isValid {
-		c.JSON(http.StatusOK, gin.H{"msg": "用户名或密码错误"})
+
+	clientIP := c.ClientIP()
+	if ttl, locked := impl.LoginLock.Check(user.Email, clientIP); locked {
+		c.JSON(http.StatusOK, gin.H{"msg": fmt.Sprintf("登录失败次数过多，请%d分钟后再试", int(math.Ceil(ttl.Minutes())))})
+		return
+	}
+	if !impl.TwoFactor.Verify(&user, body.Code) {
+		impl.LoginLock.RecordFailure(user.Email, clientIP)
+		c.JSON(http.StatusOK, gin.H{"msg": "验证码错误"})
+		return
+	}
+	// 挑战令牌只能使用一次
+	if !impl.TwoFactor.ConsumeLoginChallenge(body.ChallengeToken) {
+		c.JSON(http.StatusOK, gin.H{"msg": "login challenge expired, please login again"})
 		return
 	}
-	token, err := middleware.Auth.GenerateToken(user.ID, user.Email, "user")
+
+	a.issueTokens(c, &user)
+}
+
+// oidcStateCookie 保存单点登录state的cookie，回调时校验，确保回调来自发起登录的同一浏览器
+const oidcStateCookie = "oidc_state"
+
+// OidcLogin 发起OpenID Connect单点登录，重定向到IdP授权页面
+func (a *AuthController) OidcLogin(c *gin.Context) {
+	authURL, state, err := impl.Oidc.AuthCodeURL()
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// IdP重定向回来是顶级导航，SameSite=Lax时cookie会随回调请求发送
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 0, "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
 
-	c.JSON(200, gin.H{
-		"token":   token,
-		"message": "Login successful",
+// OidcCallback IdP授权回调，校验ID Token后登录对应的本地用户
+// 配置了前端地址时重定向并附带一次性登录码，否则直接返回token
+func (a *AuthController) OidcCallback(c *gin.Context) {
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": idpError + ": " + c.Query("error_description")})
+		return
+	}
+	browserState, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+	user, err := impl.Oidc.Callback(c.Query("state"), browserState, c.Query("code"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if impl.Oidc.FrontendURL() == "" {
+		a.issueTokens(c, user)
+		return
+	}
+	code, err := impl.Oidc.CreateLoginCode(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login code"})
+		return
+	}
+	c.Redirect(http.StatusFound, impl.Oidc.LoginCodeLink(code))
+}
+
+// OidcToken 前端使用单点登录回调返回的一次性登录码换取token
+func (a *AuthController) OidcToken(c *gin.Context) {
+	var body dto.OidcTokenBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := impl.Oidc.ConsumeLoginCode(body.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	var user dto.User
+	if err := impl.User.FindById(userID, &user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	a.issueTokens(c, &user)
+}
+
+// issueTokens 登录成功后签发令牌对
+// 密码已过期时签发只能用于修改密码的受限token，角色要求双因素认证但尚未绑定时签发只能用于绑定的受限token
+// 单点登录账户的多因素认证由IdP负责，外部账户的密码由身份提供方管理，均不做本地限制
+func (a *AuthController) issueTokens(c *gin.Context, user *dto.User) {
+	// 两步登录、单点登录登录码等从数据库重新读取的用户，签发前再次检查账户状态
+	if err := impl.User.CheckActive(user); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	pending := ""
+	if impl.PasswordPolicy.Expired(user) {
+		pending = middleware.PendingPasswordChange
+	} else if user.Provider != authProvider.Oidc && !user.TotpEnabled && impl.TwoFactor.RequiredForUser(user.ID) {
+		pending = middleware.PendingTwoFactorSetup
+	}
+
+	pair, err := middleware.Auth.GenerateRestrictedTokenPair(user.ID, user.Email, "user", pending, middleware.SessionClient{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
 	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	resp := gin.H{
+		"token":        pair.AccessToken,
+		"refreshToken": pair.RefreshToken,
+		"expiresIn":    pair.ExpiresIn,
+		"message":      "Login successful",
+	}
+	if pending != "" {
+		resp["pending"] = pending
+	}
+	if pending == middleware.PendingPasswordChange {
+		resp["mustChangePassword"] = true
+	}
+	c.JSON(200, resp)
+}
+
+// SetupTwoFactor 生成双因素认证密钥及绑定二维码，已启用时需要提供当前的验证码或恢复码
+func (a *AuthController) SetupTwoFactor(c *gin.Context) {
+	var body dto.TwoFactorSetupDto
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	userID := c.MustGet("user_id").(int64)
+	email := c.MustGet("email").(string)
+
+	setup, err := impl.TwoFactor.Setup(userID, email, body.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTwoFactor 校验验证码完成绑定，返回一次性恢复码
+// 因角色要求而登录的受限token在绑定完成后会被替换为正常token
+func (a *AuthController) ConfirmTwoFactor(c *gin.Context) {
+	var body dto.TwoFactorCodeDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(int64)
+
+	codes, err := impl.TwoFactor.Confirm(userID, body.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"message": "Two-factor authentication enabled", "recoveryCodes": codes}
+	claims := c.MustGet("claims").(*middleware.UserClaims)
+	if claims.Pending == middleware.PendingTwoFactorSetup {
+		middleware.Auth.RevokeSession(userID, claims.SessionID)
+		pair, err := middleware.Auth.GenerateTokenPair(userID, claims.Email, claims.Role, middleware.SessionClient{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		resp["token"] = pair.AccessToken
+		resp["refreshToken"] = pair.RefreshToken
+		resp["expiresIn"] = pair.ExpiresIn
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
+// DisableTwoFactor 校验验证码后关闭双因素认证
+func (a *AuthController) DisableTwoFactor(c *gin.Context) {
+	var body dto.TwoFactorCodeDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := impl.TwoFactor.Disable(c.MustGet("user_id").(int64), body.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// Profile 获取当前登录用户的信息、角色、权限和菜单
 func (a *AuthController) Profile(c *gin.Context) {
-	userID := c.MustGet("user_id").(uint)
-	username := c.MustGet("username").(string)
-	role := c.MustGet("role").(string)
+	claims, _ := middleware.CurrentClaims(c)
 
-	c.JSON(200, gin.H{
-		"user_id":  userID,
-		"username": username,
-		"role":     role,
-	})
+	profile, err := impl.Profile.Get(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// 模拟登录时返回操作者，前端据此展示模拟登录提示和退出入口
+	if claims.ImpersonatorID != 0 {
+		profile.Impersonating = true
+		profile.Impersonator = &dto.ImpersonatorVo{ID: claims.ImpersonatorID, Email: claims.ImpersonatorEmail}
+	}
+	c.JSON(http.StatusOK, profile)
 }
 
 func (a *AuthController) Logout(c *gin.Context) {
@@ -69,20 +314,131 @@ func (a *AuthController) Logout(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	// 调用Logout方法将token加入黑名单
 	middleware.Auth.Logout(tokenString)
+	// 吊销当前会话，携带刷新令牌时一并吊销其令牌族
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		middleware.Auth.RevokeSession(c.MustGet("user_id").(int64), sessionID)
+	}
+	var body dto.RefreshTokenBody
+	if err := c.ShouldBindJSON(&body); err == nil {
+		middleware.Auth.RevokeRefreshToken(body.RefreshToken)
+	}
 	c.JSON(200, gin.H{"message": "Logged out successfully"})
 }
 
+// LogoutEverywhere 退出全部设备，当前用户已签发的访问令牌和刷新令牌全部失效
+func (a *AuthController) LogoutEverywhere(c *gin.Context) {
+	count, err := middleware.Auth.LogoutEverywhere(c.MustGet("user_id").(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "count": count})
+}
+
+// Refresh 使用刷新令牌换取新的令牌对
 func (a *AuthController) Refresh(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	oldToken := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := middleware.Auth.RefreshToken(oldToken)
+	var body dto.RefreshTokenBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pair, err := middleware.Auth.RefreshToken(body.RefreshToken)
 	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"message":      "Token refreshed",
+		"token":        pair.AccessToken,
+		"refreshToken": pair.RefreshToken,
+		"expiresIn":    pair.ExpiresIn,
+	})
+}
+
+// Jwks 公开验证token所需的公钥（JWK Set）
+func (a *AuthController) Jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, middleware.Auth.JWKS())
+}
+
+// ForgotPassword 找回密码，向邮箱发送一次性重置链接
+// 无论邮箱是否存在都返回相同结果，避免被用来探测账户
+func (a *AuthController) ForgotPassword(c *gin.Context) {
+	var body dto.ForgotPasswordBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"message": "Token refreshed", "token": token})
+	// 发送失败也返回相同的结果，避免通过响应差异判断邮箱是否已注册
+	if err := impl.PasswordReset.Request(body.Email); err != nil {
+		log.Printf("password reset request for %s failed: %v", body.Email, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
 }
 
+// ResetPassword 使用邮件中的令牌重置密码，成功后吊销该用户的所有会话
+func (a *AuthController) ResetPassword(c *gin.Context) {
+	var body dto.ResetPasswordBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := impl.PasswordReset.Reset(body)
+	if err != nil {
+		if respondPolicyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := middleware.Auth.RevokeAllSessions(userID, ""); err != nil {
+		log.Printf("revoke sessions of user %d after password reset failed: %v", userID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// Register 自助注册，注册后需要先验证邮箱才能登录
 func (a *AuthController) Register(c *gin.Context) {
-	// 注册逻辑...
-	c.JSON(200, gin.H{"message": "User registered"})
+	var body dto.RegisterBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := impl.Register.Register(body)
+	if err != nil {
+		if respondPolicyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User registered, please check your email to verify the account", "user": user})
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱，验证后账户才能登录
+func (a *AuthController) VerifyEmail(c *gin.Context) {
+	var body dto.VerifyEmailBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := impl.Register.Verify(body.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerifyEmail 重新发送邮箱验证邮件
+func (a *AuthController) ResendVerifyEmail(c *gin.Context) {
+	var body dto.ResendVerifyBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 发送失败也返回相同的结果，避免通过响应差异判断账户是否待验证
+	if err := impl.Register.Resend(body.Email); err != nil {
+		log.Printf("resend verification email for %s failed: %v", body.Email, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account is awaiting verification, a new email has been sent"})
 }
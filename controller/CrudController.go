@@ -4,14 +4,17 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"tiny-admin-api-serve/impl"
 	"tiny-admin-api-serve/utils/elastic"
 
 	"github.com/gin-gonic/gin"
 )
 
 // CrudController 通用CRUD控制器基础类
+// 实体中标记了datascope标签时，查询和修改只作用于当前用户数据范围内的数据
 type CrudController[T any] struct {
-	repository *elastic.BaseRepository[T]
+	repository  *elastic.BaseRepository[T]
+	scopeFields dataScopeFields
 }
 
 // NewCrudController 创建新的CRUD控制器
@@ -28,7 +31,8 @@ func NewCrudController[T any]() (*CrudController[T], error) {
 	}
 
 	return &CrudController[T]{
-		repository: repo,
+		repository:  repo,
+		scopeFields: newDataScopeFields[T](),
 	}, nil
 }
 
@@ -41,6 +45,15 @@ func (c *CrudController[T]) Create(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	scope, err := c.scopeFields.scope(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !c.scopeFields.allows(&entity, scope) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": impl.ErrOutOfDataScope.Error()})
+		return
+	}
 
 	id, err := c.repository.Insert(ctxResponse, &entity)
 	if err != nil {
@@ -53,22 +66,14 @@ func (c *CrudController[T]) Create(ctx *gin.Context) {
 
 // GetById 根据ID获取资源
 func (c *CrudController[T]) GetById(ctx *gin.Context) {
-	ctxResponse := context.Background()
-
 	id := ctx.Param("id")
 	if id == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
 		return
 	}
 
-	entity, err := c.repository.GetById(ctxResponse, id)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get resource: " + err.Error()})
-		return
-	}
-
-	if entity == nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+	entity, ok := c.findInScope(ctx, id)
+	if !ok {
 		return
 	}
 
@@ -85,6 +90,17 @@ func (c *CrudController[T]) Update(ctx *gin.Context) {
 		return
 	}
 
+	if c.scopeFields.enabled() {
+		if _, ok := c.findInScope(ctx, elastic.GetDocumentID(&entity)); !ok {
+			return
+		}
+		scope, _ := c.scopeFields.scope(ctx)
+		if !c.scopeFields.allows(&entity, scope) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": impl.ErrOutOfDataScope.Error()})
+			return
+		}
+	}
+
 	if err := c.repository.Update(ctxResponse, &entity); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update resource: " + err.Error()})
 		return
@@ -109,6 +125,17 @@ func (c *CrudController[T]) UpdateById(ctx *gin.Context) {
 		return
 	}
 
+	if c.scopeFields.enabled() {
+		if _, ok := c.findInScope(ctx, id); !ok {
+			return
+		}
+		scope, _ := c.scopeFields.scope(ctx)
+		if !c.scopeFields.allowsUpdate(updateData, scope) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": impl.ErrOutOfDataScope.Error()})
+			return
+		}
+	}
+
 	if err := c.repository.UpdateById(ctxResponse, id, updateData); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update resource: " + err.Error()})
 		return
@@ -127,6 +154,12 @@ func (c *CrudController[T]) Delete(ctx *gin.Context) {
 		return
 	}
 
+	if c.scopeFields.enabled() {
+		if _, ok := c.findInScope(ctx, id); !ok {
+			return
+		}
+	}
+
 	if err := c.repository.DeleteById(ctxResponse, id); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete resource: " + err.Error()})
 		return
@@ -145,6 +178,14 @@ func (c *CrudController[T]) BatchDelete(ctx *gin.Context) {
 		return
 	}
 
+	if c.scopeFields.enabled() {
+		for _, id := range ids {
+			if _, ok := c.findInScope(ctx, id); !ok {
+				return
+			}
+		}
+	}
+
 	if err := c.repository.DeleteBatch(ctxResponse, ids); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to batch delete resources: " + err.Error()})
 		return
@@ -164,7 +205,12 @@ func (c *CrudController[T]) List(ctx *gin.Context) {
 		queryStruct = struct{}{}
 	}
 
-	entities, err := c.repository.ListByQueryStruct(ctxResponse, queryStruct)
+	wrapper, ok := c.scopedQuery(ctx, queryStruct)
+	if !ok {
+		return
+	}
+
+	entities, err := c.repository.List(ctxResponse, wrapper)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get resources: " + err.Error()})
 		return
@@ -198,7 +244,12 @@ func (c *CrudController[T]) Page(ctx *gin.Context) {
 		queryStruct = struct{}{}
 	}
 
-	result, err := c.repository.PageByQueryStruct(ctxResponse, queryStruct, page, size)
+	wrapper, ok := c.scopedQuery(ctx, queryStruct)
+	if !ok {
+		return
+	}
+
+	result, err := c.repository.Page(ctxResponse, wrapper, page, size)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get resources: " + err.Error()})
 		return
@@ -218,7 +269,12 @@ func (c *CrudController[T]) Count(ctx *gin.Context) {
 		queryStruct = struct{}{}
 	}
 
-	count, err := c.repository.CountByQueryStruct(ctxResponse, queryStruct)
+	wrapper, ok := c.scopedQuery(ctx, queryStruct)
+	if !ok {
+		return
+	}
+
+	count, err := c.repository.Count(ctxResponse, wrapper)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count resources: " + err.Error()})
 		return
@@ -226,3 +282,36 @@ func (c *CrudController[T]) Count(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"count": count})
 }
+
+// findInScope 获取数据范围内的资源，不存在或不在数据范围内时写入404响应
+func (c *CrudController[T]) findInScope(ctx *gin.Context, id string) (*T, bool) {
+	if id == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
+		return nil, false
+	}
+	entity, err := c.repository.GetById(context.Background(), id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get resource: " + err.Error()})
+		return nil, false
+	}
+	scope, err := c.scopeFields.scope(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if entity == nil || !c.scopeFields.allows(entity, scope) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+		return nil, false
+	}
+	return entity, true
+}
+
+// scopedQuery 根据查询结构体构建查询，并添加数据范围条件
+func (c *CrudController[T]) scopedQuery(ctx *gin.Context, queryStruct interface{}) (elastic.QueryWrapper[T], bool) {
+	scope, err := c.scopeFields.scope(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return applyDataScope(c.scopeFields, elastic.FromQueryStruct[T](queryStruct), scope), true
+}
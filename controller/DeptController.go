@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeptController struct {
+	deptService impl.DeptImpl
+}
+
+func NewDeptController() *DeptController {
+	return &DeptController{
+		deptService: impl.Dept,
+	}
+}
+
+// GetTree 获取部门树
+func (dc *DeptController) GetTree(c *gin.Context) {
+	depts, err := dc.deptService.FindTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, depts)
+}
+
+// Create 创建部门
+func (dc *DeptController) Create(c *gin.Context) {
+	var dept dto.Dept
+	if err := c.ShouldBindJSON(&dept); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := dc.deptService.CreateDept(dept)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// Update 更新部门
+func (dc *DeptController) Update(c *gin.Context) {
+	var dept dto.Dept
+	if err := c.ShouldBindJSON(&dept); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := dc.deptService.UpdateDept(dept)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete 删除部门
+func (dc *DeptController) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dept id"})
+		return
+	}
+
+	dept, err := dc.deptService.DeleteDept(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dept)
+}
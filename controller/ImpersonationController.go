@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonationController struct {
+	impersonationService impl.ImpersonationImpl
+}
+
+func NewImpersonationController() *ImpersonationController {
+	return &ImpersonationController{
+		impersonationService: impl.Impersonation,
+	}
+}
+
+// Start 以指定用户身份登录，返回的token只包含访问令牌，过期后需要重新发起
+func (ic *ImpersonationController) Start(c *gin.Context) {
+	targetID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	claims, _ := middleware.CurrentClaims(c)
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := ic.impersonationService.CheckTarget(operator, targetID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	token, jti, err := middleware.Auth.GenerateImpersonationToken(claims, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ic.impersonationService.Record(dto.ImpersonationLog{
+		ImpersonatorID:    claims.UserID,
+		ImpersonatorEmail: claims.Email,
+		TargetID:          target.ID,
+		TargetEmail:       target.Email,
+		Action:            impl.ImpersonationStart,
+		TokenId:           jti,
+		IpAddr:            c.ClientIP(),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken": token,
+		"expiresIn":   middleware.Auth.AccessTTLSeconds(),
+		"user":        target,
+		"impersonator": dto.ImpersonatorVo{
+			ID:    claims.UserID,
+			Email: claims.Email,
+		},
+	})
+}
+
+// Stop 结束模拟登录，模拟登录的token随即失效，前端切回操作者自己的token
+func (ic *ImpersonationController) Stop(c *gin.Context) {
+	claims, _ := middleware.CurrentClaims(c)
+	if claims.ImpersonatorID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if err := middleware.Auth.Logout(tokenString); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.RecordImpersonation(c, claims, impl.ImpersonationStop, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation stopped"})
+}
+
+// GetLogs 分页查询模拟登录审计日志，可按userId过滤
+func (ic *ImpersonationController) GetLogs(c *gin.Context) {
+	paginationQuery := dto.NewPaginationQueryDto()
+	if err := c.ShouldBindQuery(&paginationQuery); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var userID int64
+	if value := c.Query("userId"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+			return
+		}
+		userID = id
+	}
+
+	logs, err := ic.impersonationService.List(paginationQuery, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
@@ -19,11 +19,11 @@ func NewMenuController() *MenuController {
 	}
 }
 
-// GetMenus 根据邮箱获取菜单
+// GetMenus 获取当前用户的菜单，路径中的邮箱仅为兼容旧接口保留，不用于查询其他用户的菜单
 func (mc *MenuController) GetMenus(c *gin.Context) {
-	email := c.Param("email")
+	userId := c.MustGet("user_id").(int64)
 
-	menus, err := mc.menuService.GetMenubyEmail(email)
+	menus, err := mc.menuService.GetMenusByUserId(userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -110,3 +110,20 @@ func (pc *PermissionController) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, createPermissionDto)
 }
+
+// Expand 将权限模式（如"user::*"）展开为它当前覆盖的全部具体权限
+func (pc *PermissionController) Expand(c *gin.Context) {
+	pattern := c.Query("pattern")
+	if pattern == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pattern is required"})
+		return
+	}
+
+	permissions, err := pc.permissionService.Expand(pattern)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PolicyController struct {
+	policyService impl.PolicyImpl
+}
+
+func NewPolicyController() *PolicyController {
+	return &PolicyController{
+		policyService: impl.Policy,
+	}
+}
+
+// GetAll 查询全部访问策略
+func (pc *PolicyController) GetAll(c *gin.Context) {
+	policies, err := pc.policyService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// Create 创建访问策略
+func (pc *PolicyController) Create(c *gin.Context) {
+	var policy dto.Policy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := pc.policyService.CreatePolicy(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// Update 更新访问策略
+func (pc *PolicyController) Update(c *gin.Context) {
+	var policy dto.Policy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := pc.policyService.UpdatePolicy(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete 删除访问策略
+func (pc *PolicyController) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy id"})
+		return
+	}
+
+	policy, err := pc.policyService.DeletePolicy(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"tiny-admin-api-serve/entity/dto"
 	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,12 +28,21 @@ func (rc *RoleController) Create(c *gin.Context) {
 		return
 	}
 
-	role, err := rc.roleService.CreateRole(createRoleDto, false)
+	operator, err := middleware.CurrentOperator(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	role, err := rc.roleService.CreateRole(createRoleDto, false, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, role)
 }
 
@@ -81,8 +91,17 @@ func (rc *RoleController) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	role, err := rc.roleService.UpdateRole(updateRoleDto)
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := rc.roleService.UpdateRole(updateRoleDto, operator)
 	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -125,3 +144,58 @@ func (rc *RoleController) GetRoleInfo(c *gin.Context) {
 
 	c.JSON(http.StatusOK, role)
 }
+
+// AddPermission 为角色添加单个权限
+func (rc *RoleController) AddPermission(c *gin.Context) {
+	rc.changeAssociation(c, "permissionId", rc.roleService.AddPermission)
+}
+
+// RemovePermission 移除角色的单个权限
+func (rc *RoleController) RemovePermission(c *gin.Context) {
+	rc.changeAssociation(c, "permissionId", func(roleId, id int64, _ *impl.Operator) (*dto.Role, error) {
+		return rc.roleService.RemovePermission(roleId, id)
+	})
+}
+
+// AddMenu 为角色添加单个菜单
+func (rc *RoleController) AddMenu(c *gin.Context) {
+	rc.changeAssociation(c, "menuId", rc.roleService.AddMenu)
+}
+
+// RemoveMenu 移除角色的单个菜单
+func (rc *RoleController) RemoveMenu(c *gin.Context) {
+	rc.changeAssociation(c, "menuId", func(roleId, id int64, _ *impl.Operator) (*dto.Role, error) {
+		return rc.roleService.RemoveMenu(roleId, id)
+	})
+}
+
+// changeAssociation 解析路径中的角色ID和关联ID，以当前用户为操作者修改角色的关联并返回修改后的角色
+func (rc *RoleController) changeAssociation(c *gin.Context, param string, change func(roleId, id int64, operator *impl.Operator) (*dto.Role, error)) {
+	roleId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+		return
+	}
+
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := change(roleId, id, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
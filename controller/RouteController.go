@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"net/http"
+	"tiny-admin-api-serve/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RouteController struct {
+	registry *middleware.RouteRegistry
+}
+
+func NewRouteController() *RouteController {
+	return &RouteController{
+		registry: middleware.Routes,
+	}
+}
+
+// GetRoutes 列出全部已注册路由及其访问规则
+func (rc *RouteController) GetRoutes(c *gin.Context) {
+	c.JSON(http.StatusOK, rc.registry.List())
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"tiny-admin-api-serve/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	auth *middleware.AuthMiddleware
+}
+
+func NewSessionController() *SessionController {
+	return &SessionController{
+		auth: &middleware.Auth,
+	}
+}
+
+// GetSessions 获取当前用户的全部登录会话
+func (sc *SessionController) GetSessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(int64)
+
+	sessions, err := sc.auth.ListSessions(userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession 吊销当前用户的指定会话
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(int64)
+
+	if err := sc.auth.RevokeSession(userID, c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions 吊销当前用户除当前会话外的全部会话
+func (sc *SessionController) RevokeOtherSessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(int64)
+
+	count, err := sc.auth.RevokeAllSessions(userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "count": count})
+}
+
+// RevokeUserSessions 管理员吊销指定用户的全部会话，该用户已签发的token全部失效
+func (sc *SessionController) RevokeUserSessions(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId"})
+		return
+	}
+
+	count, err := sc.auth.LogoutEverywhere(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "count": count})
+}
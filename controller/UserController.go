@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -31,10 +33,22 @@ func (uc *UserController) GetUserInfo(c *gin.Context) {
 	}
 	// 查询用户信息
 	var user dto.User
-	if err := uc.userService.FindByEmail(email, &user); err != nil {
+	if err := uc.userService.FindDetailByEmail(email, &user); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	// 查询其他用户时只能查看数据范围内的用户
+	if c.Param("email") != "" {
+		operator, err := middleware.CurrentOperator(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !operator.DataScope().Allows(user.DeptId, user.ID) {
+			respondForbiddenError(c, impl.ErrOutOfDataScope)
+			return
+		}
+	}
 
 	// 返回用户信息
 	c.JSON(http.StatusOK, user)
@@ -47,9 +61,21 @@ func (uc *UserController) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !operator.DataScope().AllowsDept(createUserDto.DeptId) {
+		respondForbiddenError(c, impl.ErrOutOfDataScope)
+		return
+	}
 
-	userVo, err := uc.userService.CreateUser(createUserDto, false)
+	userVo, err := uc.userService.CreateUser(createUserDto, false, operator)
 	if err != nil {
+		if respondPolicyError(c, err) || respondForbiddenError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -65,12 +91,22 @@ func (uc *UserController) DelUser(c *gin.Context) {
 		return
 	}
 
-	userVo, err := uc.userService.RemoveUserInfo(email)
+	operator, err := middleware.CurrentOperator(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	userVo, err := uc.userService.RemoveUserInfo(email, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	revokeSessions(userVo.ID)
+
 	c.JSON(http.StatusOK, userVo)
 }
 
@@ -82,12 +118,21 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	userVo, err := uc.userService.UpdateUserInfo(updateUserDto)
+	operator, err := middleware.CurrentOperator(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	userVo, err := uc.userService.UpdateUserInfo(updateUserDto, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, userVo)
 }
 
@@ -122,7 +167,13 @@ func (uc *UserController) GetAllUser(c *gin.Context) {
 		}
 	}
 
-	users, err := uc.userService.GetAllUser(paginationQuery, name, email, roles)
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := uc.userService.GetAllUser(paginationQuery, name, email, roles, operator)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -141,6 +192,9 @@ func (uc *UserController) UpdatePwdAdmin(c *gin.Context) {
 
 	err := uc.userService.UpdatePwdAdmin(updatePwdAdminDto)
 	if err != nil {
+		if respondPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -156,8 +210,13 @@ func (uc *UserController) UpdatePwdUser(c *gin.Context) {
 		return
 	}
 
-	err := uc.userService.UpdatePwdUser(updatePwdUserDto)
+	// 只能修改当前登录账户的密码，受限token同样如此
+	userId := c.MustGet("user_id").(int64)
+	err := uc.userService.UpdatePwdUser(userId, updatePwdUserDto)
 	if err != nil {
+		if respondPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -165,6 +224,10 @@ func (uc *UserController) UpdatePwdUser(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	// 调用Logout方法将token加入黑名单
 	middleware.Auth.Logout(tokenString)
+	// 同时吊销当前会话，避免通过刷新令牌继续使用修改前签发的（受限）token
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		middleware.Auth.RevokeSession(userId, sessionID)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
@@ -176,11 +239,104 @@ func (uc *UserController) BatchRemoveUser(c *gin.Context) {
 		return
 	}
 
-	userVos, err := uc.userService.BatchDeleteUser(emails)
+	operator, err := middleware.CurrentOperator(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	userVos, err := uc.userService.BatchDeleteUser(emails, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, userVo := range userVos {
+		revokeSessions(userVo.ID)
+	}
+
 	c.JSON(http.StatusOK, userVos)
 }
+
+// UnlockUser 管理员解除账户或IP的登录锁定
+func (uc *UserController) UnlockUser(c *gin.Context) {
+	var unlockLoginDto dto.UnlockLoginDto
+	if err := c.ShouldBindJSON(&unlockLoginDto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := impl.LoginLock.Unlock(unlockLoginDto.Email, unlockLoginDto.Ip); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked successfully"})
+}
+
+// respondPolicyError 密码不符合策略时返回400及字段级错误
+func respondPolicyError(c *gin.Context, err error) bool {
+	var policyErr *impl.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "fields": policyErr.Fields})
+	return true
+}
+
+// AssignRoles 为多个用户批量添加角色
+func (uc *UserController) AssignRoles(c *gin.Context) {
+	uc.changeRoles(c, uc.userService.AssignRoles)
+}
+
+// UnassignRoles 批量移除多个用户的角色
+func (uc *UserController) UnassignRoles(c *gin.Context) {
+	uc.changeRoles(c, uc.userService.UnassignRoles)
+}
+
+// changeRoles 批量修改用户角色，只能修改数据范围内且访问策略允许的用户
+func (uc *UserController) changeRoles(c *gin.Context, change func(userIds, roleIds []int64, operator *impl.Operator) ([]dto.User, error)) {
+	var assignRolesDto dto.AssignRolesDto
+	if err := c.ShouldBindJSON(&assignRolesDto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	operator, err := middleware.CurrentOperator(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := change(assignRolesDto.UserIds, assignRolesDto.RoleIds, operator)
+	if err != nil {
+		if respondForbiddenError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// respondForbiddenError 操作的数据不在当前用户的数据范围内、被访问策略拒绝或无权分配角色时返回403
+func respondForbiddenError(c *gin.Context, err error) bool {
+	forbidden := []error{impl.ErrOutOfDataScope, impl.ErrPolicyDenied, impl.ErrPermissionDenied,
+		impl.ErrCannotChangeOwnRoles, impl.ErrRoleNotHeld}
+	for _, target := range forbidden {
+		if errors.Is(err, target) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return true
+		}
+	}
+	return false
+}
+
+// revokeSessions 吊销已删除用户的全部会话，token版本已在删除前失效，这里只清理残留的会话数据
+func revokeSessions(userId int64) {
+	if _, err := middleware.Auth.RevokeAllSessions(userId, ""); err != nil {
+		log.Printf("failed to revoke sessions of deleted user %d: %v", userId, err)
+	}
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/middleware"
+	"tiny-admin-api-serve/utils/elastic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataScopeTagKey 标记数据范围字段的标签，`datascope:"dept"`为所属部门，`datascope:"user"`为所属用户
+const DataScopeTagKey = "datascope"
+
+// dataScopeField 实体中参与数据范围过滤的字段
+type dataScopeField struct {
+	name  string // 字段在文档中的名称
+	index []int  // 字段在结构体中的位置
+}
+
+// dataScopeFields 实体的部门字段和所属用户字段，都为空时不按数据范围过滤
+type dataScopeFields struct {
+	dept *dataScopeField
+	user *dataScopeField
+}
+
+// newDataScopeFields 根据datascope标签查找实体的数据范围字段
+func newDataScopeFields[T any]() dataScopeFields {
+	var fields dataScopeFields
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for _, field := range reflect.VisibleFields(t) {
+		tag := field.Tag.Get(DataScopeTagKey)
+		if tag == "" {
+			continue
+		}
+		name := field.Name
+		if jsonName := strings.Split(field.Tag.Get("json"), ",")[0]; jsonName != "" && jsonName != "-" {
+			name = jsonName
+		}
+		scopeField := &dataScopeField{name: name, index: field.Index}
+		switch tag {
+		case "dept":
+			fields.dept = scopeField
+		case "user":
+			fields.user = scopeField
+		}
+	}
+	return fields
+}
+
+// enabled 实体是否需要按数据范围过滤
+func (f dataScopeFields) enabled() bool {
+	return f.dept != nil || f.user != nil
+}
+
+// scope 获取当前用户的数据范围，实体不需要过滤时返回nil，即不限制
+func (f dataScopeFields) scope(ctx *gin.Context) (*impl.UserDataScope, error) {
+	if !f.enabled() {
+		return nil, nil
+	}
+	return middleware.CurrentDataScope(ctx)
+}
+
+// applyDataScope 为查询添加数据范围条件：部门在范围内，或属于当前用户
+func applyDataScope[T any](f dataScopeFields, wrapper elastic.QueryWrapper[T], scope *impl.UserDataScope) elastic.QueryWrapper[T] {
+	if scope == nil || scope.All {
+		return wrapper
+	}
+	var conditions []elastic.QueryWrapper[T]
+	if f.dept != nil && len(scope.DeptIds) > 0 {
+		deptIds := make([]interface{}, len(scope.DeptIds))
+		for i, id := range scope.DeptIds {
+			deptIds[i] = id
+		}
+		conditions = append(conditions, elastic.NewQueryWrapper[T]().In(f.dept.name, deptIds))
+	}
+	if f.user != nil {
+		conditions = append(conditions, elastic.NewQueryWrapper[T]().Eq(f.user.name, scope.UserId))
+	}
+	if len(conditions) == 0 {
+		// 没有可访问的数据
+		conditions = append(conditions, elastic.NewQueryWrapper[T]().In(f.dept.name, []interface{}{}))
+	}
+	return wrapper.Or(conditions...)
+}
+
+// allows 实体是否在数据范围内
+func (f dataScopeFields) allows(entity interface{}, scope *impl.UserDataScope) bool {
+	if scope == nil || scope.All {
+		return true
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	var deptId *int64
+	if f.dept != nil {
+		if id, ok := int64Value(v.FieldByIndex(f.dept.index)); ok {
+			deptId = &id
+		}
+	}
+	var userId int64
+	if f.user != nil {
+		userId, _ = int64Value(v.FieldByIndex(f.user.index))
+	}
+	return scope.Allows(deptId, userId)
+}
+
+// allowsUpdate 按字段名更新时，更新后的部门是否在数据范围内，未更新部门时返回true
+func (f dataScopeFields) allowsUpdate(update map[string]interface{}, scope *impl.UserDataScope) bool {
+	if scope == nil || scope.All || f.dept == nil {
+		return true
+	}
+	value, ok := update[f.dept.name]
+	if !ok {
+		return true
+	}
+	var deptId *int64
+	if id, ok := int64Value(reflect.ValueOf(value)); ok {
+		deptId = &id
+	}
+	return scope.AllowsDept(deptId)
+}
+
+// int64Value 将整数、浮点数（JSON解析的数字）或其指针转换为int64
+func int64Value(v reflect.Value) (int64, bool) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package dto
+
+import "time"
+
+// ApiKey 个人访问令牌，供CI、脚本等机器客户端调用接口，只保存密钥的哈希
+type ApiKey struct {
+	ID         int64      `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	UserID     int64      `json:"userId" gorm:"column:user_id;index"`
+	Name       string     `json:"name" gorm:"column:name;size:100"`
+	KeyId      string     `json:"keyId" gorm:"column:key_id;size:32;uniqueIndex"` // 公开的密钥标识，用于查找记录
+	SecretHash string     `json:"-" gorm:"column:secret_hash;size:64"`
+	Scopes     []string   `json:"scopes" gorm:"column:scopes;type:text;serializer:json"` // 可使用的权限，必须是所属用户权限的子集
+	ExpiresAt  *time.Time `json:"expiresAt" gorm:"column:expires_at"`                    // 为空表示永不过期
+	LastUsedAt *time.Time `json:"lastUsedAt" gorm:"column:last_used_at"`
+	LastUsedIp string     `json:"lastUsedIp" gorm:"column:last_used_ip;size:64"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"column:created_at"`
+}
+
+// TableName 指定表名
+func (ApiKey) TableName() string {
+	return "api_key"
+}
+
+type CreateApiKeyDto struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays"` // 有效天数，0表示永不过期
+}
+
+// ApiKeyCreatedVo 创建成功后返回的完整密钥，只在创建时返回一次
+type ApiKeyCreatedVo struct {
+	ApiKey *ApiKey `json:"apiKey"`
+	Key    string  `json:"key"`
+}
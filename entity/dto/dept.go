@@ -0,0 +1,34 @@
+package dto
+
+// Dept 部门，通过ParentId组成部门树，用于按部门限制数据范围
+type Dept struct {
+	ID       int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name     string `json:"name" gorm:"column:name" binding:"required"`
+	ParentId *int64 `json:"parentId" gorm:"column:parent_id;index"`
+	Order    int    `json:"order" gorm:"column:order"`
+}
+
+// TableName 指定表名
+func (Dept) TableName() string {
+	return "dept"
+}
+
+// DeptVo 部门树节点
+type DeptVo struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	ParentId *int64   `json:"parentId"`
+	Order    int      `json:"order"`
+	Children []DeptVo `json:"children"`
+}
+
+// RoleDept 角色与部门的关联，数据范围为custom时使用
+type RoleDept struct {
+	RoleID int64 `gorm:"primaryKey;column:role_id"`
+	DeptID int64 `gorm:"primaryKey;column:dept_id"`
+}
+
+// TableName 指定表名
+func (RoleDept) TableName() string {
+	return "role_dept"
+}
@@ -0,0 +1,28 @@
+package dto
+
+import "time"
+
+// ImpersonationLog 模拟登录审计日志，记录开始、结束及模拟期间的每个请求
+type ImpersonationLog struct {
+	ID                int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	ImpersonatorID    int64     `json:"impersonatorId" gorm:"column:impersonator_id;index"`
+	ImpersonatorEmail string    `json:"impersonatorEmail" gorm:"column:impersonator_email"`
+	TargetID          int64     `json:"targetId" gorm:"column:target_id;index"`
+	TargetEmail       string    `json:"targetEmail" gorm:"column:target_email"`
+	Action            string    `json:"action" gorm:"column:action;size:20"` // start、stop或request
+	Detail            string    `json:"detail" gorm:"column:detail"`         // 请求的方法和路径
+	TokenId           string    `json:"tokenId" gorm:"column:token_id;size:64;index"`
+	IpAddr            string    `json:"ipAddr" gorm:"column:ip_addr;size:64"`
+	CreatedAt         time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// TableName 指定表名
+func (ImpersonationLog) TableName() string {
+	return "impersonation_log"
+}
+
+// ImpersonatorVo 模拟登录的操作者
+type ImpersonatorVo struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
@@ -10,3 +10,10 @@ type Permission struct {
 func (Permission) TableName() string {
 	return "permission"
 }
+
+// PermissionSyncVo 按路由同步权限的结果
+type PermissionSyncVo struct {
+	Created  []string `json:"created"`  // 新建的权限
+	Orphaned []string `json:"orphaned"` // 没有任何路由使用的权限（不含通配符权限），只报告不删除
+	Granted  []string `json:"granted"`  // 授予管理员角色的权限
+}
@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+// Policy 访问策略，在RBAC权限校验通过后，按主体、资源和环境属性进一步判断是否允许操作
+type Policy struct {
+	ID          int64             `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name        string            `json:"name" gorm:"column:name;size:100" binding:"required"`
+	Description string            `json:"description" gorm:"column:description"`
+	Effect      string            `json:"effect" gorm:"column:effect;size:10" binding:"required,oneof=allow deny"` // 见policyEffect
+	Actions     []string          `json:"actions" gorm:"column:actions;serializer:json" binding:"required,min=1"`  // 适用的权限编码，支持通配符
+	Conditions  []PolicyCondition `json:"conditions" gorm:"column:conditions;serializer:json"`                     // 全部满足时策略生效
+	Disabled    bool              `json:"disabled" gorm:"column:disabled"`
+	CreatedAt   time.Time         `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt   time.Time         `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+// TableName 指定表名
+func (Policy) TableName() string {
+	return "policy"
+}
+
+// PolicyCondition 策略条件
+// Attribute为subject.*、resource.*或env.*属性，Value可以是常量，也可以用"${subject.department}"引用其他属性
+type PolicyCondition struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value"`
+}
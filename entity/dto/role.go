@@ -1,16 +1,27 @@
 package dto
 
 type CreateRoleDto struct {
-	Name          string  `json:"name" binding:"required"`
-	PermissionIds []int64 `json:"permissionIds" binding:"required"`
-	MenuIds       []int64 `json:"menuIds" binding:"required"`
+	Name             string  `json:"name" binding:"required"`
+	ParentId         *int64  `json:"parentId"` // 上级角色，继承其权限和菜单
+	PermissionIds    []int64 `json:"permissionIds" binding:"required"`
+	MenuIds          []int64 `json:"menuIds" binding:"required"`
+	RequireTwoFactor bool    `json:"requireTwoFactor"`
+	DataScope        string  `json:"dataScope"` // 数据范围，见dataScope，为空时为全部数据
+	DeptIds          []int64 `json:"deptIds"`   // 数据范围为custom时可访问的部门
 }
 
 type Role struct {
-	ID          int64        `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name        string       `json:"name" gorm:"column:name"`
-	Permissions []Permission `json:"permission,omitempty" gorm:"many2many:role_permission;"`
-	Menus       []Menu       `json:"menus,omitempty" gorm:"many2many:role_menu;"`
+	ID               int64        `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name             string       `json:"name" gorm:"column:name"`
+	ParentId         *int64       `json:"parentId" gorm:"column:parent_id;index"`                 // 上级角色，角色继承上级角色链上的全部权限和菜单
+	RequireTwoFactor bool         `json:"requireTwoFactor" gorm:"column:require_two_factor"`      // 拥有该角色的用户必须启用双因素认证
+	DataScope        string       `json:"dataScope" gorm:"column:data_scope;size:20;default:all"` // 数据范围，见dataScope
+	Depts            []Dept       `json:"depts,omitempty" gorm:"many2many:role_dept;"`            // 数据范围为custom时可访问的部门
+	Permissions      []Permission `json:"permission,omitempty" gorm:"many2many:role_permission;"`
+	Menus            []Menu       `json:"menus,omitempty" gorm:"many2many:role_menu;"`
+	// 包含继承自上级角色的权限和菜单，只在查询角色详情时填充
+	EffectivePermissions []Permission `json:"effectivePermissions,omitempty" gorm:"-"`
+	EffectiveMenus       []Menu       `json:"effectiveMenus,omitempty" gorm:"-"`
 }
 
 // TableName 指定表名
@@ -19,10 +30,14 @@ func (Role) TableName() string {
 }
 
 type UpdateRoleDto struct {
-	ID            int     `json:"id" binding:"required"`
-	Name          string  `json:"name" binding:"required"`
-	PermissionIds []int64 `json:"permissionIds" binding:"required"`
-	MenuIds       []int64 `json:"menuIds" binding:"required"`
+	ID               int     `json:"id" binding:"required"`
+	Name             string  `json:"name" binding:"required"`
+	ParentId         *int64  `json:"parentId"` // 上级角色，为空时取消继承
+	PermissionIds    []int64 `json:"permissionIds" binding:"required"`
+	MenuIds          []int64 `json:"menuIds" binding:"required"`
+	RequireTwoFactor *bool   `json:"requireTwoFactor"`
+	DataScope        string  `json:"dataScope"` // 为空时不修改
+	DeptIds          []int64 `json:"deptIds"`   // 数据范围为custom时可访问的部门
 }
 type RolePMVo struct {
 	RoleInfo *PageWrapper[Role] `json:"roleInfo"`
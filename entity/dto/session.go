@@ -0,0 +1,11 @@
+package dto
+
+// SessionVo 登录会话信息
+type SessionVo struct {
+	ID        string `json:"id"`
+	IpAddr    string `json:"ipAddr"`
+	Os        string `json:"os"`
+	Browser   string `json:"browser"`
+	LoginTime string `json:"loginTime"`
+	Current   bool   `json:"current"` // 是否为当前请求所用的会话
+}
@@ -0,0 +1,35 @@
+package dto
+
+// UserRecoveryCode 双因素认证恢复码，只保存哈希，每个恢复码只能使用一次
+type UserRecoveryCode struct {
+	ID       int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	UserID   int64  `json:"userId" gorm:"column:user_id;index"`
+	CodeHash string `json:"-" gorm:"column:code_hash;size:64"`
+	Used     bool   `json:"used" gorm:"column:used"`
+}
+
+// TableName 指定表名
+func (UserRecoveryCode) TableName() string {
+	return "user_recovery_code"
+}
+
+// TotpSetupVo 双因素认证绑定信息
+type TotpSetupVo struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`    // otpauth地址
+	QrCode string `json:"qrCode"` // 二维码图片（data URI）
+}
+
+type TwoFactorCodeDto struct {
+	Code string `json:"code" binding:"required"` // TOTP验证码或恢复码
+}
+
+// TwoFactorSetupDto 重新绑定双因素认证时需要提供当前的验证码或恢复码，首次绑定时为空
+type TwoFactorSetupDto struct {
+	Code string `json:"code"`
+}
+
+type LoginTwoFactorBody struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP验证码或恢复码
+}
@@ -1,28 +1,64 @@
 package dto
 
+import "time"
+
 type LoginBody struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// RegisterBody 自助注册请求
+type RegisterBody struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// OidcTokenBody 使用单点登录回调返回的一次性登录码换取token
+type OidcTokenBody struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// VerifyEmailBody 使用邮件中的令牌验证邮箱
+type VerifyEmailBody struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerifyBody 重新发送邮箱验证邮件
+type ResendVerifyBody struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type RefreshTokenBody struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
 type User struct {
-	ID                int64  `json:"id" gorm:"primaryKey;autoIncrement" form:"id"`
-	Address           string `json:"address" form:"address"`
-	CreateTime        string `json:"createTime" form:"create_time"`
-	Department        string `json:"department" form:"department"`
-	Email             string `json:"email" form:"email"`
-	EmployeeType      string `json:"employeeType" form:"employee_type"`
-	Name              string `json:"name" form:"name"`
-	Password          string `json:"-" form:"password"`
-	ProbationDuration string `json:"probationDuration" form:"probation_duration"`
-	ProbationEnd      string `json:"probationEnd" form:"probation_end"`
-	ProbationStart    string `json:"probationStart" form:"probation_start"`
-	ProtocolEnd       string `json:"protocolEnd" form:"protocol_end"`
-	ProtocolStart     string `json:"protocolStart" form:"protocol_start"`
-	Salt              string `json:"-" form:"salt"`
-	Status            int    `json:"status" form:"status"`
-	UpdateTime        string `json:"updateTime" form:"update_time"`
-	Roles             []Role `json:"role" gorm:"many2many:user_role;foreignKey:id;joinForeignKey:user_id;References:id;joinReferences:role_id"`
+	ID                int64      `json:"id" gorm:"primaryKey;autoIncrement" form:"id" datascope:"user"`
+	Address           string     `json:"address" form:"address"`
+	CreateTime        string     `json:"createTime" form:"create_time"`
+	Department        string     `json:"department" form:"department"`
+	DeptId            *int64     `json:"deptId" form:"dept_id" gorm:"column:dept_id;index" datascope:"dept"` // 所属部门，用于数据范围过滤
+	Email             string     `json:"email" form:"email"`
+	EmployeeType      string     `json:"employeeType" form:"employee_type"`
+	Name              string     `json:"name" form:"name"`
+	Password          string     `json:"-" form:"password"`
+	ProbationDuration string     `json:"probationDuration" form:"probation_duration"`
+	ProbationEnd      string     `json:"probationEnd" form:"probation_end"`
+	ProbationStart    string     `json:"probationStart" form:"probation_start"`
+	ProtocolEnd       string     `json:"protocolEnd" form:"protocol_end"`
+	ProtocolStart     string     `json:"protocolStart" form:"protocol_start"`
+	Salt              string     `json:"-" form:"salt"`
+	Status            int        `json:"status" form:"status"`
+	UpdateTime        string     `json:"updateTime" form:"update_time"`
+	PasswordUpdatedAt *time.Time `json:"passwordUpdatedAt" gorm:"column:password_updated_at"`   // 最近一次修改密码的时间
+	Provider          string     `json:"provider" gorm:"column:provider;size:20;default:local"` // 账户来源，见authProvider
+	TokenVersion      int64      `json:"-" gorm:"column:token_version;default:0"`               // token版本，递增后此前签发的token全部失效
+	TotpSecret        string     `json:"-" gorm:"column:totp_secret"`                           // TOTP密钥（base32）
+	TotpEnabled       bool       `json:"totpEnabled" gorm:"column:totp_enabled"`                // 是否已启用双因素认证
+	Roles             []Role     `json:"role" gorm:"many2many:user_role;foreignKey:id;joinForeignKey:user_id;References:id;joinReferences:role_id"`
+	Locked            bool       `json:"locked" gorm:"-"`                // 是否因登录失败次数过多被锁定
+	LockedUntil       string     `json:"lockedUntil,omitempty" gorm:"-"` // 锁定截止时间
 }
 
 func (User) TableName() string {
@@ -35,12 +71,21 @@ type GetInfo struct {
 	Roles       []string `json:"roles"`
 	Permissions []string `json:"permissions"`
 }
+
+// ProfileVo 当前登录用户的资料，一次返回用户信息、角色、权限编码和菜单树
+type ProfileVo struct {
+	GetInfo
+	Menus         []MenuVo        `json:"menus"`
+	Impersonating bool            `json:"impersonating"`          // 是否为模拟登录
+	Impersonator  *ImpersonatorVo `json:"impersonator,omitempty"` // 模拟登录的操作者
+}
 type CreateUserDto struct {
 	Name              string  `json:"name" binding:"required"`
 	Email             string  `json:"email" binding:"required"`
 	Password          string  `json:"password" binding:"required"`
 	RoleIds           []int64 `json:"roleIds"`
 	Department        string  `json:"department"`
+	DeptId            *int64  `json:"deptId"`
 	EmployeeType      string  `json:"employeeType"`
 	ProbationStart    string  `json:"probationStart" binding:"required"`
 	ProbationEnd      string  `json:"probationEnd" binding:"required"`
@@ -57,6 +102,7 @@ type UpdateUserDto struct {
 	Email             string  `json:"email" binding:"required"`
 	RoleIds           []int64 `json:"roleIds" binding:"required"`
 	Department        string  `json:"department" binding:"required"`
+	DeptId            *int64  `json:"deptId"`
 	EmployeeType      string  `json:"employeeType" binding:"required"`
 	ProbationStart    string  `json:"probationStart" binding:"required"`
 	ProbationEnd      string  `json:"probationEnd" binding:"required"`
@@ -70,12 +116,54 @@ type UpdateUserDto struct {
 type UpdatePwdAdminDto struct {
 	Email              string `json:"email" binding:"required"`
 	NewPassword        string `json:"newPassword" binding:"required"`
-	ConfirmNewPassword string `json:"confirmNewPassword"`
+	ConfirmNewPassword string `json:"confirmNewPassword" binding:"required"`
 }
 
+// UpdatePwdUserDto 用户修改自己的密码，账户以登录token为准
 type UpdatePwdUserDto struct {
-	Email       string `json:"email"`
 	Token       string `json:"token"`
 	NewPassword string `json:"newPassword" binding:"required"`
 	OldPassword string `json:"oldPassword" binding:"required"`
 }
+
+// AssignRolesDto 为多个用户批量添加或移除角色
+type AssignRolesDto struct {
+	UserIds []int64 `json:"userIds" binding:"required,min=1"`
+	RoleIds []int64 `json:"roleIds" binding:"required,min=1"`
+}
+
+type UnlockLoginDto struct {
+	Email string `json:"email"`
+	Ip    string `json:"ip"`
+}
+
+// PasswordHistory 历史密码哈希，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	UserID    int64     `json:"userId" gorm:"column:user_id;index"`
+	Password  string    `json:"-" gorm:"column:password"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// TableName 指定表名
+func (PasswordHistory) TableName() string {
+	return "user_password_history"
+}
+
+// FieldError 字段级校验错误，供前端在对应输入框下展示
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ForgotPasswordBody 找回密码请求
+type ForgotPasswordBody struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordBody 使用邮件中的令牌重置密码
+type ResetPasswordBody struct {
+	Token              string `json:"token" binding:"required"`
+	NewPassword        string `json:"newPassword" binding:"required"`
+	ConfirmNewPassword string `json:"confirmNewPassword" binding:"required"`
+}
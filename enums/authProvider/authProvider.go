@@ -0,0 +1,7 @@
+package authProvider
+
+const (
+	Local = "local" // 本地账户密码
+	Oidc  = "oidc"  // OpenID Connect 单点登录
+	Ldap  = "ldap"  // LDAP / Active Directory
+)
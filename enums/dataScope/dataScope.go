@@ -0,0 +1,18 @@
+package dataScope
+
+const (
+	All          = "all"            // 全部数据
+	Dept         = "dept"           // 本部门数据
+	DeptAndChild = "dept_and_child" // 本部门及下级部门数据
+	Self         = "self"           // 仅本人数据
+	Custom       = "custom"         // 角色指定的部门数据
+)
+
+// Valid 是否为支持的数据范围
+func Valid(scope string) bool {
+	switch scope {
+	case All, Dept, DeptAndChild, Self, Custom:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,6 @@
+package policyEffect
+
+const (
+	Allow = "allow" // 条件全部满足时允许；同一操作存在allow策略时，必须满足其中之一
+	Deny  = "deny"  // 条件全部满足时拒绝，优先于allow
+)
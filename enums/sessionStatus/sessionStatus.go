@@ -15,4 +15,5 @@ const (
 	Os              = "os"
 	Browser         = "browser"
 	DataScopeAspect = "dataScopeAspect"
+	OperatorAspect  = "operatorAspect"
 )
@@ -0,0 +1,7 @@
+package userStatus
+
+const (
+	Disable    = 0 // 停用
+	Enable     = 1 // 正常
+	Unverified = 2 // 自助注册后尚未验证邮箱，不能登录
+)
@@ -0,0 +1,134 @@
+package impl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/userStatus"
+	"tiny-admin-api-serve/utils"
+)
+
+const (
+	apiKeyPrefix        = "tpk"       // 密钥前缀，便于在日志和代码仓库中识别泄露的密钥
+	apiKeyTouchInterval = time.Minute // 最近使用时间的最小更新间隔，避免每次请求都写库
+)
+
+var errInvalidApiKey = errors.New("invalid api key")
+
+type ApiKeyImpl struct {
+}
+
+var ApiKey = ApiKeyImpl{}
+
+// Create 为用户创建API密钥，scopes必须是用户当前拥有权限的子集
+func (a ApiKeyImpl) Create(userId int64, createApiKeyDto dto.CreateApiKeyDto) (*dto.ApiKeyCreatedVo, error) {
+	owned, err := Profile.Permissions(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range createApiKeyDto.Scopes {
+		if !utils.HasPermission(owned, scope) {
+			return nil, fmt.Errorf("scope %s is not granted to the user", scope)
+		}
+	}
+
+	idBuf := make([]byte, 8)
+	secretBuf := make([]byte, 32)
+	if _, err := rand.Read(idBuf); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secretBuf); err != nil {
+		return nil, err
+	}
+	keyId := hex.EncodeToString(idBuf)
+	secret := base64.RawURLEncoding.EncodeToString(secretBuf)
+
+	apiKey := dto.ApiKey{
+		UserID:     userId,
+		Name:       createApiKeyDto.Name,
+		KeyId:      keyId,
+		SecretHash: hashApiKeySecret(secret),
+		Scopes:     createApiKeyDto.Scopes,
+	}
+	if createApiKeyDto.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, createApiKeyDto.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := utils.Db.DB.Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+
+	return &dto.ApiKeyCreatedVo{
+		ApiKey: &apiKey,
+		Key:    fmt.Sprintf("%s_%s_%s", apiKeyPrefix, keyId, secret),
+	}, nil
+}
+
+// List 获取用户的全部API密钥
+func (a ApiKeyImpl) List(userId int64) ([]dto.ApiKey, error) {
+	var apiKeys []dto.ApiKey
+	err := utils.Db.DB.Where("user_id = ?", userId).Order("id DESC").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+// Delete 删除（吊销）用户的API密钥
+func (a ApiKeyImpl) Delete(userId, id int64) error {
+	result := utils.Db.DB.Where("id = ? AND user_id = ?", id, userId).Delete(&dto.ApiKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("api key not found")
+	}
+	return nil
+}
+
+// Authenticate 校验API密钥，返回密钥记录及所属用户，并记录最近使用时间和IP
+func (a ApiKeyImpl) Authenticate(key, clientIP string) (*dto.ApiKey, *dto.User, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, nil, errInvalidApiKey
+	}
+
+	var apiKey dto.ApiKey
+	if err := utils.Db.DB.Where("key_id = ?", parts[1]).First(&apiKey).Error; err != nil {
+		return nil, nil, errInvalidApiKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashApiKeySecret(parts[2])), []byte(apiKey.SecretHash)) != 1 {
+		return nil, nil, errInvalidApiKey
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, nil, errors.New("api key has expired")
+	}
+
+	var user dto.User
+	if err := User.FindById(apiKey.UserID, &user); err != nil {
+		return nil, nil, errInvalidApiKey
+	}
+	// 所属账户停用或尚未验证时密钥不可用
+	if user.Status != userStatus.Enable {
+		return nil, nil, errInvalidApiKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval || apiKey.LastUsedIp != clientIP {
+		utils.Db.DB.Model(&dto.ApiKey{}).Where("id = ?", apiKey.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP})
+		apiKey.LastUsedAt = &now
+		apiKey.LastUsedIp = clientIP
+	}
+	return &apiKey, &user, nil
+}
+
+// 密钥本身是32字节随机数，使用sha256即可，无需慢哈希
+func hashApiKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package impl
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/authProvider"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+)
+
+var (
+	// ErrInvalidCredentials 账户不存在或密码错误，计入登录失败次数
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrProviderUnavailable 认证服务不可用，不计入登录失败次数
+	ErrProviderUnavailable = errors.New("authentication provider unavailable")
+	// ErrAccountDisabled 账户已停用，不能登录
+	ErrAccountDisabled = errors.New("account is disabled")
+	// ErrAccountUnverified 自助注册的账户尚未验证邮箱，不能登录
+	ErrAccountUnverified = errors.New("email is not verified")
+)
+
+// Authenticator 账户密码认证器
+type Authenticator interface {
+	// Authenticate 校验账户密码，成功时返回本地用户
+	Authenticate(email, password string) (*dto.User, error)
+}
+
+// AuthenticatorChainImpl 根据配置为每次登录选择认证器
+type AuthenticatorChainImpl struct {
+	authenticators map[string]Authenticator
+}
+
+var Authenticators = AuthenticatorChainImpl{
+	authenticators: map[string]Authenticator{
+		authProvider.Local: localAuthenticator{},
+		authProvider.Ldap:  ldapAuthenticator{},
+	},
+}
+
+// Authenticate 选择认证器并校验账户密码
+func (a AuthenticatorChainImpl) Authenticate(email, password string) (*dto.User, error) {
+	provider := a.providerFor(email)
+	authenticator, ok := a.authenticators[provider]
+	if !ok {
+		// 例如OIDC账户没有可用的密码，只能通过单点登录
+		return nil, ErrInvalidCredentials
+	}
+	user, err := authenticator.Authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+	// 密码正确后再检查账户状态，避免未知密码时探测账户状态
+	if err := User.CheckActive(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// providerFor 选择认证方式：应急账户 -> 用户自身的认证方式（非本地时）-> 邮箱域名 -> 默认认证方式
+func (a AuthenticatorChainImpl) providerFor(email string) string {
+	config := setting.Conf.AuthConfig
+	if config == nil {
+		config = &setting.AuthConfig{}
+	}
+	for _, breakGlass := range config.BreakGlass {
+		if strings.EqualFold(breakGlass, email) {
+			return authProvider.Local
+		}
+	}
+
+	var user dto.User
+	if err := User.FindByEmail(email, &user); err == nil && !User.IsLocal(&user) {
+		return user.Provider
+	}
+
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		domain := email[at+1:]
+		for _, domainProvider := range config.DomainProviders {
+			if strings.EqualFold(domainProvider.Domain, domain) {
+				return domainProvider.Provider
+			}
+		}
+	}
+
+	if config.DefaultProvider != "" {
+		return config.DefaultProvider
+	}
+	return authProvider.Local
+}
+
+// localAuthenticator 本地账户密码认证
+type localAuthenticator struct {
+}
+
+func (l localAuthenticator) Authenticate(email, password string) (*dto.User, error) {
+	var user dto.User
+	if err := User.FindByEmail(email, &user); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	isValid, err := utils.VerifyPassword(password, user.Salt, user.Password)
+	if err != nil || !isValid {
+		return nil, ErrInvalidCredentials
+	}
+	// 旧格式密码在登录成功后静默升级为新的哈希格式
+	if utils.NeedsRehash(user.Password) {
+		if err := User.RehashPassword(user.ID, password); err != nil {
+			log.Printf("failed to rehash password for user %d: %v", user.ID, err)
+		}
+	}
+	return &user, nil
+}
@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+)
+
+const cacheEvictChannel = "cache:evict" // 集群部署时广播缓存失效消息的Redis频道
+
+// cacheEvictMessage 缓存失效消息，其他节点收到后清除对应的进程内缓存
+type cacheEvictMessage struct {
+	UserIds  []int64 `json:"userIds,omitempty"`  // 需要清除资料缓存的用户
+	AllUsers bool    `json:"allUsers,omitempty"` // 清除全部用户的资料缓存
+	Policies bool    `json:"policies,omitempty"` // 重新加载访问策略
+}
+
+// publishCacheEvict 集群部署时通知其他节点清除进程内缓存，单机部署时不需要
+func publishCacheEvict(message cacheEvictMessage) {
+	if !setting.Conf.Cluster {
+		return
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	if err := utils.Redis.Publish(context.Background(), cacheEvictChannel, body); err != nil {
+		log.Printf("failed to publish cache eviction: %v", err)
+	}
+}
+
+// ListenCacheEvict 集群部署时订阅缓存失效消息，断开后自动重新订阅；启动时调用一次
+func ListenCacheEvict() {
+	if !setting.Conf.Cluster {
+		return
+	}
+	go func() {
+		for {
+			err := utils.Redis.Subscribe(context.Background(), cacheEvictChannel, handleCacheEvict)
+			log.Printf("cache eviction subscription stopped, retrying: %v", err)
+			// 订阅中断期间可能错过消息，重新订阅前清空进程内缓存
+			Profile.evictAllLocal()
+			Policy.reload()
+			time.Sleep(time.Second)
+		}
+	}()
+}
+
+func handleCacheEvict(payload string) {
+	var message cacheEvictMessage
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		log.Printf("invalid cache eviction message %q: %v", payload, err)
+		return
+	}
+	if message.AllUsers {
+		Profile.evictAllLocal()
+	} else {
+		Profile.evictLocal(message.UserIds...)
+	}
+	if message.Policies {
+		Policy.reload()
+	}
+}
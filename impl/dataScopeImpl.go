@@ -0,0 +1,101 @@
+package impl
+
+import (
+	"errors"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/dataScope"
+	"tiny-admin-api-serve/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrOutOfDataScope 操作的数据不在当前用户的数据范围内
+var ErrOutOfDataScope = errors.New("data is outside your data scope")
+
+// UserDataScope 用户可访问的数据范围，由用户全部角色的数据范围合并而来
+// 为nil或All为true时不限制；否则可访问DeptIds中部门的数据，以及本人的数据
+type UserDataScope struct {
+	All     bool
+	DeptIds []int64
+	UserId  int64
+}
+
+// Apply 为查询添加数据范围条件，deptColumn为部门列，userColumn为所属用户列
+func (s *UserDataScope) Apply(db *gorm.DB, deptColumn, userColumn string) *gorm.DB {
+	if s == nil || s.All {
+		return db
+	}
+	if len(s.DeptIds) == 0 {
+		return db.Where(userColumn+" = ?", s.UserId)
+	}
+	return db.Where("("+deptColumn+" IN ? OR "+userColumn+" = ?)", s.DeptIds, s.UserId)
+}
+
+// Allows 数据范围是否包含指定部门或用户的数据
+func (s *UserDataScope) Allows(deptId *int64, userId int64) bool {
+	if s == nil || s.All {
+		return true
+	}
+	if userId != 0 && userId == s.UserId {
+		return true
+	}
+	return s.AllowsDept(deptId)
+}
+
+// AllowsDept 数据范围是否包含指定部门，未分配部门的数据只在不限制时可访问
+func (s *UserDataScope) AllowsDept(deptId *int64) bool {
+	if s == nil || s.All {
+		return true
+	}
+	return deptId != nil && utils.IsInArray(*deptId, s.DeptIds)
+}
+
+type DataScopeImpl struct {
+}
+
+var DataScope = DataScopeImpl{}
+
+// ForUser 计算用户的数据范围，多个角色取并集，任一角色为全部数据时不限制
+// 没有角色的用户只能访问本人的数据
+func (d DataScopeImpl) ForUser(userId int64) (*UserDataScope, error) {
+	var user dto.User
+	if err := utils.Db.DB.Preload("Roles.Depts").Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	scope := &UserDataScope{UserId: userId}
+	var deptIds, treeRoots []int64
+	for _, role := range user.Roles {
+		switch role.DataScope {
+		case dataScope.All, "":
+			scope.All = true
+			return scope, nil
+		case dataScope.Dept:
+			if user.DeptId != nil {
+				deptIds = append(deptIds, *user.DeptId)
+			}
+		case dataScope.DeptAndChild:
+			if user.DeptId != nil {
+				treeRoots = append(treeRoots, *user.DeptId)
+			}
+		case dataScope.Custom:
+			for _, dept := range role.Depts {
+				deptIds = append(deptIds, dept.ID)
+			}
+		}
+	}
+
+	if len(treeRoots) > 0 {
+		descendants, err := Dept.WithDescendants(treeRoots...)
+		if err != nil {
+			return nil, err
+		}
+		deptIds = append(deptIds, descendants...)
+	}
+	for _, id := range deptIds {
+		if !utils.IsInArray(id, scope.DeptIds) {
+			scope.DeptIds = append(scope.DeptIds, id)
+		}
+	}
+	return scope, nil
+}
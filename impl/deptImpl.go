@@ -0,0 +1,164 @@
+package impl
+
+import (
+	"errors"
+	"sort"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/utils"
+
+	"gorm.io/gorm"
+)
+
+type DeptImpl struct {
+	BaseImpl
+}
+
+var Dept = DeptImpl{}
+
+// FindTree 获取部门树
+func (d DeptImpl) FindTree() ([]dto.DeptVo, error) {
+	var depts []dto.Dept
+	if err := utils.Db.DB.Order("`order` ASC").Find(&depts).Error; err != nil {
+		return nil, err
+	}
+	return d.buildTree(depts), nil
+}
+
+// CreateDept 创建部门
+func (d DeptImpl) CreateDept(dept dto.Dept) (*dto.Dept, error) {
+	if dept.ParentId != nil {
+		var parent dto.Dept
+		if err := utils.Db.DB.Where("id = ?", *dept.ParentId).First(&parent).Error; err != nil {
+			return nil, errors.New("parent dept not found")
+		}
+	}
+	newDept := dto.Dept{
+		Name:     dept.Name,
+		ParentId: dept.ParentId,
+		Order:    dept.Order,
+	}
+	if err := utils.Db.DB.Create(&newDept).Error; err != nil {
+		return nil, err
+	}
+	return &newDept, nil
+}
+
+// UpdateDept 更新部门，上级部门不能是自身或下级部门
+func (d DeptImpl) UpdateDept(updateDept dto.Dept) (*dto.Dept, error) {
+	var dept dto.Dept
+	if err := utils.Db.DB.Where("id = ?", updateDept.ID).First(&dept).Error; err != nil {
+		return nil, errors.New("dept not found")
+	}
+
+	if updateDept.ParentId != nil {
+		descendants, err := d.WithDescendants(dept.ID)
+		if err != nil {
+			return nil, err
+		}
+		if utils.IsInArray(*updateDept.ParentId, descendants) {
+			return nil, errors.New("parent dept cannot be itself or its child")
+		}
+		var parent dto.Dept
+		if err := utils.Db.DB.Where("id = ?", *updateDept.ParentId).First(&parent).Error; err != nil {
+			return nil, errors.New("parent dept not found")
+		}
+	}
+
+	dept.Name = updateDept.Name
+	dept.ParentId = updateDept.ParentId
+	dept.Order = updateDept.Order
+	if err := utils.Db.DB.Save(&dept).Error; err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// DeleteDept 删除部门，存在下级部门或用户时不能删除
+func (d DeptImpl) DeleteDept(id int64) (*dto.Dept, error) {
+	var dept dto.Dept
+	if err := utils.Db.DB.Where("id = ?", id).First(&dept).Error; err != nil {
+		return nil, errors.New("dept not found")
+	}
+
+	var childCount int64
+	utils.Db.DB.Model(&dto.Dept{}).Where("parent_id = ?", id).Count(&childCount)
+	if childCount > 0 {
+		return nil, errors.New("dept has child depts, cannot delete")
+	}
+	var userCount int64
+	utils.Db.DB.Model(&dto.User{}).Where("dept_id = ?", id).Count(&userCount)
+	if userCount > 0 {
+		return nil, errors.New("dept has users, cannot delete")
+	}
+
+	err := utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM role_dept WHERE dept_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&dept).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// WithDescendants 获取指定部门及其全部下级部门的ID
+func (d DeptImpl) WithDescendants(ids ...int64) ([]int64, error) {
+	var depts []dto.Dept
+	if err := utils.Db.DB.Select("id", "parent_id").Find(&depts).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[int64][]int64)
+	for _, dept := range depts {
+		if dept.ParentId != nil {
+			children[*dept.ParentId] = append(children[*dept.ParentId], dept.ID)
+		}
+	}
+
+	visited := make(map[int64]bool)
+	result := make([]int64, 0, len(ids))
+	queue := append([]int64{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		result = append(result, id)
+		queue = append(queue, children[id]...)
+	}
+	return result, nil
+}
+
+// buildTree 构建部门树，上级部门不存在的部门作为根节点
+func (d DeptImpl) buildTree(depts []dto.Dept) []dto.DeptVo {
+	exists := make(map[int64]bool, len(depts))
+	for _, dept := range depts {
+		exists[dept.ID] = true
+	}
+
+	var build func(parentId *int64) []dto.DeptVo
+	build = func(parentId *int64) []dto.DeptVo {
+		nodes := make([]dto.DeptVo, 0)
+		for _, dept := range depts {
+			isRoot := dept.ParentId == nil || !exists[*dept.ParentId]
+			if (parentId == nil && isRoot) || (parentId != nil && dept.ParentId != nil && *dept.ParentId == *parentId) {
+				id := dept.ID
+				nodes = append(nodes, dto.DeptVo{
+					ID:       dept.ID,
+					Name:     dept.Name,
+					ParentId: dept.ParentId,
+					Order:    dept.Order,
+					Children: build(&id),
+				})
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].Order < nodes[j].Order
+		})
+		return nodes
+	}
+	return build(nil)
+}
@@ -0,0 +1,199 @@
+package impl
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/userStatus"
+	"tiny-admin-api-serve/utils"
+
+	"gorm.io/gorm"
+)
+
+// externalAccount 外部身份提供方（OIDC、LDAP）认证通过后返回的账户信息
+type externalAccount struct {
+	Provider string
+	Email    string
+	Name     string
+	Groups   []string // 组名称或组DN
+	// EmailVerified 身份提供方是否证明了邮箱归属，未证明时只能登录此前已由该身份提供方接管的账户
+	EmailVerified bool
+}
+
+// externalSyncOptions 外部账户同步到本地用户的规则
+type externalSyncOptions struct {
+	GroupRoles  map[string]string // 组到本地角色名称的映射，组不区分大小写
+	AutoCreate  bool              // 本地不存在时是否自动创建用户
+	DefaultRole string            // 自动创建且没有匹配到任何组时分配的角色
+}
+
+// syncExternalUser 按邮箱匹配本地用户，不存在时按配置自动创建，并根据组映射同步角色
+// 只有映射表中出现的角色由外部身份提供方同步，手动分配的其他角色保持不变
+func syncExternalUser(account externalAccount, options externalSyncOptions) (*dto.User, error) {
+	var user dto.User
+	err := utils.Db.DB.Preload("Roles").Where("email = ?", account.Email).First(&user).Error
+	created := false
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if !options.AutoCreate {
+			return nil, errors.New("user not found")
+		}
+		if user, err = createExternalUser(account); err != nil {
+			return nil, err
+		}
+		created = true
+	}
+
+	if !created && user.Provider != account.Provider && !account.EmailVerified {
+		return nil, errors.New("email is not verified by the identity provider")
+	}
+	// 自助注册后未验证的账户只证明了注册者知道该邮箱，不能证明是邮箱所有者，
+	// 由身份提供方接管：清除注册者设置的密码和双因素认证后再激活，避免账户被预先劫持
+	if user.Status == userStatus.Unverified {
+		if err := takeOverUnverifiedUser(&user, account.Provider); err != nil {
+			return nil, err
+		}
+	}
+	if err := User.CheckActive(&user); err != nil {
+		return nil, err
+	}
+	// 外部账户的姓名以身份提供方为准
+	if !created && user.Provider == account.Provider && account.Name != "" && account.Name != user.Name {
+		utils.Db.DB.Model(&dto.User{}).Where("id = ?", user.ID).Update("name", account.Name)
+		user.Name = account.Name
+	}
+
+	groups := make([]string, len(account.Groups))
+	for i, group := range account.Groups {
+		groups[i] = strings.ToLower(group)
+	}
+	var mappedRoleNames, grantedRoleNames []string
+	for group, roleName := range options.GroupRoles {
+		mappedRoleNames = append(mappedRoleNames, roleName)
+		if utils.IsInArray(strings.ToLower(group), groups) && !utils.IsInArray(roleName, grantedRoleNames) {
+			grantedRoleNames = append(grantedRoleNames, roleName)
+		}
+	}
+	if created && len(grantedRoleNames) == 0 && options.DefaultRole != "" {
+		grantedRoleNames = append(grantedRoleNames, options.DefaultRole)
+	}
+
+	roles := make([]dto.Role, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		if !utils.IsInArray(role.Name, mappedRoleNames) {
+			roles = append(roles, role)
+		}
+	}
+	if len(grantedRoleNames) > 0 {
+		var granted []dto.Role
+		if err := utils.Db.DB.Where("name IN ?", grantedRoleNames).Find(&granted).Error; err != nil {
+			return nil, err
+		}
+		roles = append(roles, granted...)
+	}
+	if !sameRoles(user.Roles, roles) {
+		if err := utils.Db.DB.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return nil, err
+		}
+		Profile.Invalidate(user.ID)
+		// 角色变化后此前签发的token全部失效
+		if !created {
+			if err := TokenVersion.Bump(user.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	user.Roles = roles
+	return &user, nil
+}
+
+// createExternalUser 创建外部账户对应的本地用户，本地密码为随机值，只能通过身份提供方登录
+func createExternalUser(account externalAccount) (dto.User, error) {
+	password, err := randomToken()
+	if err != nil {
+		return dto.User{}, err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return dto.User{}, err
+	}
+	name := account.Name
+	if name == "" {
+		name = strings.SplitN(account.Email, "@", 2)[0]
+	}
+	now := time.Now()
+	user := dto.User{
+		Email:             account.Email,
+		Name:              name,
+		Password:          hashedPassword,
+		Status:            userStatus.Enable,
+		Provider:          account.Provider,
+		PasswordUpdatedAt: &now,
+	}
+	if err := utils.Db.DB.Create(&user).Error; err != nil {
+		return dto.User{}, err
+	}
+	return user, nil
+}
+
+// takeOverUnverifiedUser 将未验证的本地账户交给外部身份提供方：重置密码为随机值，关闭双因素认证，
+// 删除恢复码和历史密码，此前签发的token全部失效，然后激活账户
+func takeOverUnverifiedUser(user *dto.User, provider string) error {
+	password, err := randomToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dto.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password":     hashedPassword,
+			"salt":         "",
+			"totp_secret":  "",
+			"totp_enabled": false,
+			"provider":     provider,
+			"status":       userStatus.Enable,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&dto.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&dto.PasswordHistory{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := TokenVersion.Bump(user.ID); err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	user.Salt = ""
+	user.TotpSecret = ""
+	user.TotpEnabled = false
+	user.Provider = provider
+	user.Status = userStatus.Enable
+	return nil
+}
+
+// sameRoles 两组角色是否相同（不考虑顺序）
+func sameRoles(a, b []dto.Role) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[int64]bool, len(a))
+	for _, role := range a {
+		ids[role.ID] = true
+	}
+	for _, role := range b {
+		if !ids[role.ID] {
+			return false
+		}
+	}
+	return true
+}
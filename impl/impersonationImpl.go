@@ -0,0 +1,114 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/utils"
+)
+
+const (
+	ImpersonationStart   = "start"
+	ImpersonationStop    = "stop"
+	ImpersonationRequest = "request"
+)
+
+type ImpersonationImpl struct {
+}
+
+var Impersonation = ImpersonationImpl{}
+
+// impersonationQueue 待写入的审计日志，由后台协程依次写入数据库，避免每个请求同步写库
+var (
+	impersonationQueue     = make(chan dto.ImpersonationLog, 1024)
+	impersonationQueueOnce sync.Once
+)
+
+// CheckTarget 校验操作者是否可以模拟登录目标用户：不能模拟自己，目标用户须在操作者的数据范围内，
+// 且权限不能超出操作者的权限
+func (i ImpersonationImpl) CheckTarget(operator *Operator, targetId int64) (*dto.User, error) {
+	impersonatorId := operator.UserId
+	if impersonatorId == targetId {
+		return nil, errors.New("cannot impersonate yourself")
+	}
+	var target dto.User
+	if err := User.FindById(targetId, &target); err != nil {
+		return nil, errors.New("user not found")
+	}
+	if err := User.CheckActive(&target); err != nil {
+		return nil, fmt.Errorf("cannot impersonate this user: %w", err)
+	}
+	if !operator.DataScope().Allows(target.DeptId, target.ID) {
+		return nil, ErrOutOfDataScope
+	}
+
+	owned, err := Profile.Permissions(impersonatorId)
+	if err != nil {
+		return nil, err
+	}
+	targetPermissions, err := Profile.Permissions(targetId)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range targetPermissions {
+		if !utils.HasPermission(owned, permission) {
+			return nil, errors.New("cannot impersonate a user with permissions you do not have")
+		}
+	}
+	return &target, nil
+}
+
+// Record 写入审计日志，写入失败只记录到日志，不影响请求
+func (i ImpersonationImpl) Record(entry dto.ImpersonationLog) {
+	if err := utils.Db.DB.Create(&entry).Error; err != nil {
+		log.Printf("failed to record impersonation %s of user %d by %d: %v", entry.Action, entry.TargetID, entry.ImpersonatorID, err)
+	}
+}
+
+// RecordAsync 异步写入审计日志，队列已满时同步写入，保证记录不丢失
+func (i ImpersonationImpl) RecordAsync(entry dto.ImpersonationLog) {
+	impersonationQueueOnce.Do(func() {
+		go func() {
+			for entry := range impersonationQueue {
+				i.Record(entry)
+			}
+		}()
+	})
+	select {
+	case impersonationQueue <- entry:
+	default:
+		i.Record(entry)
+	}
+}
+
+// List 查询审计日志，userId不为0时只返回该用户作为操作者或被模拟者的记录
+func (i ImpersonationImpl) List(paginationQuery dto.PaginationQueryDto, userId int64) (*dto.PageWrapper[dto.ImpersonationLog], error) {
+	query := utils.Db.DB.Model(&dto.ImpersonationLog{})
+	if userId != 0 {
+		query = query.Where("impersonator_id = ? OR target_id = ?", userId, userId)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var logs []dto.ImpersonationLog
+	offset := (paginationQuery.Page - 1) * paginationQuery.Limit
+	if err := query.Order("id DESC").Offset(offset).Limit(paginationQuery.Limit).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	totalPages := 1
+	if paginationQuery.Limit > 0 {
+		totalPages = int((total + int64(paginationQuery.Limit) - 1) / int64(paginationQuery.Limit))
+	}
+	return dto.NewPageWrapper[dto.ImpersonationLog](
+		logs,
+		total,
+		len(logs),
+		paginationQuery.Limit,
+		totalPages,
+		paginationQuery.Page,
+	), nil
+}
@@ -0,0 +1,134 @@
+package impl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/authProvider"
+	"tiny-admin-api-serve/setting"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const defaultLdapTimeout = 5 * time.Second
+
+// ldapAuthenticator LDAP / Active Directory认证：使用服务账户查找用户DN，再以用户DN和密码绑定
+type ldapAuthenticator struct {
+}
+
+func (l ldapAuthenticator) Authenticate(email, password string) (*dto.User, error) {
+	config := setting.Conf.LdapConfig
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("%w: ldap is not configured", ErrProviderUnavailable)
+	}
+	// 空密码会被LDAP服务器当作匿名绑定而成功，必须拒绝
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.connect(config)
+	if err != nil {
+		log.Printf("ldap connect failed: %v", err)
+		return nil, ErrProviderUnavailable
+	}
+	defer conn.Close()
+
+	if config.BindDN != "" {
+		if err := conn.Bind(config.BindDN, config.BindPassword); err != nil {
+			log.Printf("ldap service account bind failed: %v", err)
+			return nil, ErrProviderUnavailable
+		}
+	}
+
+	emailAttr := valueOrDefault(config.EmailAttr, "mail")
+	nameAttr := valueOrDefault(config.NameAttr, "displayName")
+	groupAttr := valueOrDefault(config.GroupAttr, "memberOf")
+	filter := valueOrDefault(config.UserFilter, "(mail=%s)")
+	result, err := conn.Search(ldap.NewSearchRequest(
+		config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(l.timeout(config).Seconds()), false,
+		strings.ReplaceAll(filter, "%s", ldap.EscapeFilter(email)),
+		[]string{emailAttr, nameAttr, groupAttr}, nil,
+	))
+	if err != nil {
+		log.Printf("ldap search failed: %v", err)
+		return nil, ErrProviderUnavailable
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		log.Printf("ldap user bind failed: %v", err)
+		return nil, ErrProviderUnavailable
+	}
+
+	accountEmail := entry.GetAttributeValue(emailAttr)
+	if accountEmail == "" {
+		accountEmail = email
+	}
+	groupRoles := make(map[string]string, len(config.GroupRoles))
+	for _, groupRole := range config.GroupRoles {
+		groupRoles[groupRole.Group] = groupRole.Role
+	}
+	return syncExternalUser(externalAccount{
+		Provider: authProvider.Ldap,
+		Email:    accountEmail,
+		Name:     entry.GetAttributeValue(nameAttr),
+		Groups:   entry.GetAttributeValues(groupAttr),
+		// 目录中的邮箱由管理员维护
+		EmailVerified: true,
+	}, externalSyncOptions{
+		GroupRoles:  groupRoles,
+		AutoCreate:  config.AutoCreate,
+		DefaultRole: config.DefaultRole,
+	})
+}
+
+// connect 连接LDAP服务器，ldap://连接按配置升级为TLS
+func (l ldapAuthenticator) connect(config *setting.LdapConfig) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ServerName = u.Hostname()
+
+	timeout := l.timeout(config)
+	conn, err := ldap.DialURL(config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	if config.StartTLS && strings.HasPrefix(strings.ToLower(config.URL), "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (l ldapAuthenticator) timeout(config *setting.LdapConfig) time.Duration {
+	if config.Timeout > 0 {
+		return time.Duration(config.Timeout) * time.Second
+	}
+	return defaultLdapTimeout
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
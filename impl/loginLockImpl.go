@@ -0,0 +1,147 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+)
+
+type LoginLockImpl struct {
+}
+
+var LoginLock = LoginLockImpl{}
+
+// loginLockPolicy 登录锁定策略
+type loginLockPolicy struct {
+	maxFailures   int64
+	ipMaxFailures int64
+	window        time.Duration
+	lockout       time.Duration
+}
+
+// policy 读取login配置，未配置的项使用默认值
+func (l LoginLockImpl) policy() loginLockPolicy {
+	policy := loginLockPolicy{
+		maxFailures:   5,
+		ipMaxFailures: 20,
+		window:        15 * time.Minute,
+		lockout:       30 * time.Minute,
+	}
+	conf := setting.Conf.LoginConfig
+	if conf == nil {
+		return policy
+	}
+	if conf.MaxFailures > 0 {
+		policy.maxFailures = conf.MaxFailures
+	}
+	if conf.IpMaxFailures > 0 {
+		policy.ipMaxFailures = conf.IpMaxFailures
+	}
+	if conf.FailureWindow > 0 {
+		policy.window = time.Duration(conf.FailureWindow) * time.Minute
+	}
+	if conf.LockoutDuration > 0 {
+		policy.lockout = time.Duration(conf.LockoutDuration) * time.Minute
+	}
+	return policy
+}
+
+// Check 检查账户或客户端IP是否被锁定，返回剩余锁定时间
+func (l LoginLockImpl) Check(email, ip string) (time.Duration, bool) {
+	ctx := context.Background()
+	for _, key := range []string{accountLockKey(email), ipLockKey(ip)} {
+		ttl, err := utils.Redis.TTL(ctx, key)
+		if err == nil && ttl > 0 {
+			return ttl, true
+		}
+	}
+	return 0, false
+}
+
+// RecordFailure 记录一次登录失败，账户或IP达到阈值时锁定
+func (l LoginLockImpl) RecordFailure(email, ip string) error {
+	ctx := context.Background()
+	policy := l.policy()
+
+	count, err := utils.Redis.IncrWithExpire(ctx, accountFailureKey(email), policy.window)
+	if err != nil {
+		return err
+	}
+	if count >= policy.maxFailures {
+		if err := utils.Redis.SetStr(ctx, accountLockKey(email), "1", policy.lockout); err != nil {
+			return err
+		}
+		_ = utils.Redis.DelByKey(ctx, accountFailureKey(email))
+	}
+
+	count, err = utils.Redis.IncrWithExpire(ctx, ipFailureKey(ip), policy.window)
+	if err != nil {
+		return err
+	}
+	if count >= policy.ipMaxFailures {
+		if err := utils.Redis.SetStr(ctx, ipLockKey(ip), "1", policy.lockout); err != nil {
+			return err
+		}
+		_ = utils.Redis.DelByKey(ctx, ipFailureKey(ip))
+	}
+	return nil
+}
+
+// Reset 登录成功后清除账户的失败计数
+func (l LoginLockImpl) Reset(email string) error {
+	return utils.Redis.DelByKey(context.Background(), accountFailureKey(email))
+}
+
+// Unlock 管理员解除账户和/或IP的锁定
+func (l LoginLockImpl) Unlock(email, ip string) error {
+	if email == "" && ip == "" {
+		return errors.New("email or ip is required")
+	}
+	ctx := context.Background()
+	if email != "" {
+		if err := utils.Redis.DelByKey(ctx, accountLockKey(email)); err != nil {
+			return err
+		}
+		if err := utils.Redis.DelByKey(ctx, accountFailureKey(email)); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		if err := utils.Redis.DelByKey(ctx, ipLockKey(ip)); err != nil {
+			return err
+		}
+		if err := utils.Redis.DelByKey(ctx, ipFailureKey(ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockedUntil 获取账户的锁定截止时间
+func (l LoginLockImpl) LockedUntil(email string) (time.Time, bool) {
+	ttl, err := utils.Redis.TTL(context.Background(), accountLockKey(email))
+	if err != nil || ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(ttl), true
+}
+
+func accountFailureKey(email string) string {
+	return fmt.Sprintf("login_fail:account:%s", strings.ToLower(email))
+}
+
+func accountLockKey(email string) string {
+	return fmt.Sprintf("login_lock:account:%s", strings.ToLower(email))
+}
+
+func ipFailureKey(ip string) string {
+	return fmt.Sprintf("login_fail:ip:%s", ip)
+}
+
+func ipLockKey(ip string) string {
+	return fmt.Sprintf("login_lock:ip:%s", ip)
+}
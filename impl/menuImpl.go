@@ -13,38 +13,10 @@ type MenuImpl struct {
 
 var Menu = MenuImpl{}
 
-// GetMenubyEmail 根据邮箱获取菜单
-func (m MenuImpl) GetMenubyEmail(email string) ([]dto.MenuVo, error) {
-	// 1. 通过email获取用户，并预加载角色信息
-	var user dto.User
-	err := utils.Db.DB.Preload("Roles").Where("email = ?", email).First(&user).Error
-	if err != nil {
-		return nil, errors.New("user not found")
-	}
-
-	// 2. 获取用户的所有角色ID
-	var roles = user.Roles
-	if len(roles) == 0 {
-		return []dto.MenuVo{}, nil
-	}
-	roleIds := make([]int64, len(roles))
-	for i, role := range roles {
-		roleIds[i] = role.ID
-	}
-
-	// 3. 获取这些角色关联的所有菜单
-	menus, err := m.FindMenusByRoleIds(roleIds)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(menus) == 0 {
-		return []dto.MenuVo{}, nil
-	}
-
-	// 4. 构建菜单树
-	menuTree := m.buildMenuTree(menus)
-	return menuTree, nil
+// GetMenusByUserId 获取用户可见的菜单
+func (m MenuImpl) GetMenusByUserId(userId int64) ([]dto.MenuVo, error) {
+	// 菜单树按用户缓存，角色或菜单变化时失效
+	return Profile.Menus(userId)
 }
 
 // FindAllMenu 获取所有菜单
@@ -122,6 +94,7 @@ func (m MenuImpl) UpdateMenu(updateMenuDto dto.Menu) (bool, error) {
 	if result.Error != nil {
 		return false, result.Error
 	}
+	Profile.InvalidateAll()
 
 	return true, nil
 }
@@ -154,6 +127,7 @@ func (m MenuImpl) DeleteMenu(id int64, parentId int64) (*dto.Menu, error) {
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	Profile.InvalidateAll()
 
 	return &menu, nil
 }
@@ -224,8 +198,12 @@ func (m MenuImpl) convertToVo(menu dto.Menu) dto.MenuVo {
 	return menuVo
 }
 
-// FindMenusByRoleIds 根据角色IDs查询关联的菜单
+// FindMenusByRoleIds 根据角色IDs查询关联的菜单，包含继承自上级角色的菜单
 func (m MenuImpl) FindMenusByRoleIds(roleIds []int64) ([]dto.Menu, error) {
+	roleIds, err := Role.WithAncestors(roleIds)
+	if err != nil {
+		return nil, err
+	}
 	var menus []dto.Menu
 	result := utils.Db.DB.
 		Distinct().
@@ -0,0 +1,50 @@
+package impl
+
+import (
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/utils"
+)
+
+// migrateColumn 需要补充到已有表中的列
+type migrateColumn struct {
+	model interface{}
+	field string
+}
+
+// newColumns 在已有表上新增的列，只添加缺失的列，不修改已有列
+var newColumns = []migrateColumn{
+	{&dto.User{}, "TotpSecret"},
+	{&dto.User{}, "TotpEnabled"},
+	{&dto.Role{}, "RequireTwoFactor"},
+	{&dto.User{}, "PasswordUpdatedAt"},
+	{&dto.User{}, "Provider"},
+	{&dto.User{}, "TokenVersion"},
+	{&dto.User{}, "DeptId"},
+	{&dto.Role{}, "DataScope"},
+	{&dto.Role{}, "ParentId"},
+}
+
+// newTables 新增的表
+var newTables = []interface{}{
+	&dto.UserRecoveryCode{},
+	&dto.PasswordHistory{},
+	&dto.ApiKey{},
+	&dto.ImpersonationLog{},
+	&dto.Dept{},
+	&dto.RoleDept{},
+	&dto.Policy{},
+}
+
+// AutoMigrate 启动时同步数据库结构：创建新增的表，并为已有表补充缺失的列
+func AutoMigrate() error {
+	migrator := utils.Db.DB.Migrator()
+	for _, column := range newColumns {
+		if migrator.HasColumn(column.model, column.field) {
+			continue
+		}
+		if err := migrator.AddColumn(column.model, column.field); err != nil {
+			return err
+		}
+	}
+	return utils.Db.DB.AutoMigrate(newTables...)
+}
@@ -0,0 +1,284 @@
+package impl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/authProvider"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateTTL     = 10 * time.Minute // 授权请求（state）有效期
+	oidcLoginCodeTTL = time.Minute      // 回调后一次性登录码的有效期
+	oidcHTTPTimeout  = 10 * time.Second
+)
+
+// oidcState 发起授权请求时保存的状态，回调时校验
+type oidcState struct {
+	Verifier string `json:"verifier"` // PKCE code_verifier
+	Nonce    string `json:"nonce"`
+}
+
+// oidcClaims ID Token中使用的声明
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+type OidcImpl struct {
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+var Oidc = &OidcImpl{}
+
+func (o *OidcImpl) config() (*setting.OidcConfig, error) {
+	config := setting.Conf.OidcConfig
+	if config == nil || !config.Enabled {
+		return nil, errors.New("oidc login is disabled")
+	}
+	return config, nil
+}
+
+// ctx 使用带超时的HTTP客户端访问IdP；配置了discovery_url时允许发现地址与issuer不同
+func (o *OidcImpl) ctx(config *setting.OidcConfig) context.Context {
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: oidcHTTPTimeout})
+	if config.DiscoveryURL != "" && config.DiscoveryURL != config.Issuer {
+		ctx = oidc.InsecureIssuerURLContext(ctx, config.Issuer)
+	}
+	return ctx
+}
+
+// getProvider 首次使用时通过发现文档初始化IdP信息，失败时下次请求重试
+func (o *OidcImpl) getProvider(config *setting.OidcConfig) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	discoveryURL := config.DiscoveryURL
+	if discoveryURL == "" {
+		discoveryURL = config.Issuer
+	}
+	provider, err := oidc.NewProvider(o.ctx(config), discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	o.provider = provider
+	return provider, nil
+}
+
+func (o *OidcImpl) oauth2Config(config *setting.OidcConfig, provider *oidc.Provider) *oauth2.Config {
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range config.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+// AuthCodeURL 生成授权地址，state、nonce和PKCE verifier保存在Redis中供回调校验
+// 返回的state需要由调用方保存在浏览器中（cookie），回调时与地址中的state比较，防止登录CSRF
+func (o *OidcImpl) AuthCodeURL() (authURL string, stateValue string, err error) {
+	config, err := o.config()
+	if err != nil {
+		return "", "", err
+	}
+	provider, err := o.getProvider(config)
+	if err != nil {
+		return "", "", err
+	}
+
+	stateValue, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	state := oidcState{Verifier: oauth2.GenerateVerifier(), Nonce: nonce}
+	data, _ := json.Marshal(state)
+	if err := utils.Redis.SetStr(context.Background(), oidcStateKey(stateValue), string(data), oidcStateTTL); err != nil {
+		return "", "", err
+	}
+
+	return o.oauth2Config(config, provider).AuthCodeURL(stateValue,
+		oidc.Nonce(nonce), oauth2.S256ChallengeOption(state.Verifier)), stateValue, nil
+}
+
+// Callback 处理授权回调：校验state与发起登录的浏览器绑定的state一致，使用授权码和PKCE verifier换取ID Token并校验，返回对应的本地用户
+func (o *OidcImpl) Callback(stateValue, browserState, code string) (*dto.User, error) {
+	if stateValue == "" || subtle.ConstantTimeCompare([]byte(stateValue), []byte(browserState)) != 1 {
+		return nil, errors.New("oidc state does not match the browser session")
+	}
+	config, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := o.getProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.Redis.GetDel(context.Background(), oidcStateKey(stateValue))
+	if err != nil {
+		return nil, errors.New("oidc state is invalid or expired")
+	}
+	var state oidcState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, errors.New("oidc state is invalid or expired")
+	}
+
+	account, err := o.exchange(config, provider, state, code)
+	if err != nil {
+		return nil, err
+	}
+	return syncExternalUser(*account, externalSyncOptions{
+		GroupRoles:  config.GroupRoles,
+		AutoCreate:  config.AutoCreate,
+		DefaultRole: config.DefaultRole,
+	})
+}
+
+// exchange 使用授权码和PKCE verifier换取ID Token，校验签名、issuer、audience、有效期和nonce后返回外部账户信息
+func (o *OidcImpl) exchange(config *setting.OidcConfig, provider *oidc.Provider, state oidcState, code string) (*externalAccount, error) {
+	ctx := o.ctx(config)
+	token, err := o.oauth2Config(config, provider).Exchange(ctx, code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc response has no id_token")
+	}
+	// 校验签名（IdP的JWKS）、issuer、audience和有效期
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id_token verification failed: %w", err)
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, errors.New("oidc nonce mismatch")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if claims.Email == "" {
+		return nil, errors.New("oidc id_token has no email claim")
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return nil, errors.New("oidc email is not verified")
+	}
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return nil, err
+	}
+
+	return &externalAccount{
+		Provider: authProvider.Oidc,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Groups:   o.groups(config, rawClaims),
+		// 未返回email_verified时不能证明邮箱归属
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+	}, nil
+}
+
+// CreateLoginCode 生成一次性登录码，前端使用登录码换取token，避免token出现在回调地址中
+func (o *OidcImpl) CreateLoginCode(userId int64) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	err = utils.Redis.SetStr(context.Background(), oidcLoginCodeKey(code), strconv.FormatInt(userId, 10), oidcLoginCodeTTL)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeLoginCode 使用一次性登录码，返回对应的用户ID
+func (o *OidcImpl) ConsumeLoginCode(code string) (int64, error) {
+	value, err := utils.Redis.GetDel(context.Background(), oidcLoginCodeKey(code))
+	if err != nil {
+		return 0, errors.New("login code is invalid or expired")
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// FrontendURL 登录完成后跳转的前端地址，为空时回调直接返回token
+func (o *OidcImpl) FrontendURL() string {
+	if setting.Conf.OidcConfig == nil {
+		return ""
+	}
+	return setting.Conf.OidcConfig.FrontendURL
+}
+
+// LoginCodeLink 拼接带一次性登录码的前端地址
+func (o *OidcImpl) LoginCodeLink(code string) string {
+	return appendQuery(o.FrontendURL(), "code", code)
+}
+
+// groups 读取ID Token中的组声明，兼容数组和单个字符串
+func (o *OidcImpl) groups(config *setting.OidcConfig, claims map[string]interface{}) []string {
+	name := config.GroupsClaim
+	if name == "" {
+		name = "groups"
+	}
+	var groups []string
+	switch value := claims[name].(type) {
+	case []interface{}:
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	case string:
+		groups = append(groups, value)
+	}
+	return groups
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func oidcStateKey(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return fmt.Sprintf("oidc_state:%s", hex.EncodeToString(sum[:]))
+}
+
+func oidcLoginCodeKey(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return fmt.Sprintf("oidc_login:%s", hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,204 @@
+package impl
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tiny-admin-api-serve/setting"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdp 模拟的OpenID Connect身份提供方，令牌端点返回claims函数生成的ID Token
+type mockIdp struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	verifier string
+	claims   func(issuer string) jwt.MapClaims
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdp{key: key, verifier: "test-verifier-0123456789-0123456789-0123456789"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.server.URL
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") != idp.verifier {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims(idp.server.URL))
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func TestOidcExchange(t *testing.T) {
+	validClaims := func(issuer string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer,
+			"sub":            "user-1",
+			"aud":            "client",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          "nonce-1",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice",
+			"groups":         []string{"admins", "devs"},
+		}
+	}
+	with := func(changes jwt.MapClaims) func(issuer string) jwt.MapClaims {
+		return func(issuer string) jwt.MapClaims {
+			claims := validClaims(issuer)
+			for key, value := range changes {
+				if value == nil {
+					delete(claims, key)
+				} else {
+					claims[key] = value
+				}
+			}
+			return claims
+		}
+	}
+
+	tests := []struct {
+		name          string
+		claims        func(issuer string) jwt.MapClaims
+		code          string
+		verifier      string
+		nonce         string
+		wantErr       string
+		wantVerified  bool
+		wantGroupsLen int
+	}{
+		{name: "valid", claims: validClaims, wantVerified: true, wantGroupsLen: 2},
+		{name: "email_verified missing", claims: with(jwt.MapClaims{"email_verified": nil}), wantVerified: false, wantGroupsLen: 2},
+		{name: "email not verified", claims: with(jwt.MapClaims{"email_verified": false}), wantErr: "not verified"},
+		{name: "missing email", claims: with(jwt.MapClaims{"email": nil}), wantErr: "no email"},
+		{name: "nonce mismatch", claims: validClaims, nonce: "other", wantErr: "nonce mismatch"},
+		{name: "wrong audience", claims: with(jwt.MapClaims{"aud": "someone-else"}), wantErr: "verification failed"},
+		{name: "wrong issuer", claims: with(jwt.MapClaims{"iss": "https://evil.example.com"}), wantErr: "verification failed"},
+		{name: "expired", claims: with(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}), wantErr: "verification failed"},
+		{name: "bad code", claims: validClaims, code: "stolen-code", wantErr: "code exchange failed"},
+		{name: "bad pkce verifier", claims: validClaims, verifier: "wrong-verifier", wantErr: "code exchange failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdp(t)
+			idp.claims = tt.claims
+			config := &setting.OidcConfig{
+				Enabled:      true,
+				Issuer:       idp.server.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURL:  "http://localhost/auth/oidc/callback",
+			}
+			o := &OidcImpl{}
+			provider, err := o.getProvider(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := oidcState{Verifier: idp.verifier, Nonce: "nonce-1"}
+			if tt.verifier != "" {
+				state.Verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				state.Nonce = tt.nonce
+			}
+			code := "good-code"
+			if tt.code != "" {
+				code = tt.code
+			}
+
+			account, err := o.exchange(config, provider, state, code)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("exchange() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange() error = %v", err)
+			}
+			if account.Email != "alice@example.com" || account.Name != "Alice" {
+				t.Errorf("exchange() account = %+v", account)
+			}
+			if account.EmailVerified != tt.wantVerified {
+				t.Errorf("EmailVerified = %v, want %v", account.EmailVerified, tt.wantVerified)
+			}
+			if len(account.Groups) != tt.wantGroupsLen {
+				t.Errorf("Groups = %v, want %d groups", account.Groups, tt.wantGroupsLen)
+			}
+		})
+	}
+}
+
+func TestOidcCallbackRejectsUnboundState(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        string
+		browserState string
+	}{
+		{name: "no cookie", state: "state-1", browserState: ""},
+		{name: "different cookie", state: "state-1", browserState: "state-2"},
+		{name: "empty state", state: "", browserState: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&OidcImpl{}).Callback(tt.state, tt.browserState, "good-code")
+			if err == nil || !strings.Contains(err.Error(), "browser session") {
+				t.Fatalf("Callback() error = %v, want browser session mismatch", err)
+			}
+		})
+	}
+}
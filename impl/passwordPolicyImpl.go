@@ -0,0 +1,159 @@
+package impl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// defaultPasswordDenylist 内置的常见弱密码
+var defaultPasswordDenylist = []string{
+	"123456", "12345678", "123456789", "1234567890", "111111", "000000",
+	"password", "password1", "password123", "qwerty", "qwerty123", "abc123",
+	"admin", "admin123", "admin@123", "iloveyou", "welcome", "letmein", "p@ssw0rd",
+}
+
+type PasswordPolicyImpl struct {
+}
+
+var PasswordPolicy = PasswordPolicyImpl{}
+
+// PolicyError 密码策略校验失败，包含字段级错误信息
+type PolicyError struct {
+	Fields []dto.FieldError
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// policy 读取password_policy配置，未配置时使用默认值
+func (p PasswordPolicyImpl) policy() setting.PasswordPolicy {
+	if setting.Conf.PasswordPolicy == nil {
+		return setting.PasswordPolicy{MinLength: 8}
+	}
+	return *setting.Conf.PasswordPolicy
+}
+
+// Validate 按密码策略校验新密码，user为空时（如新建用户）不校验历史密码
+func (p PasswordPolicyImpl) Validate(field, password string, user *dto.User) error {
+	policy := p.policy()
+	var fields []dto.FieldError
+	addError := func(format string, args ...interface{}) {
+		fields = append(fields, dto.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len([]rune(password)) < policy.MinLength {
+		addError("密码长度不能少于%d位", policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireUpper && !hasUpper {
+		addError("密码必须包含大写字母")
+	}
+	if policy.RequireLower && !hasLower {
+		addError("密码必须包含小写字母")
+	}
+	if policy.RequireDigit && !hasDigit {
+		addError("密码必须包含数字")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		addError("密码必须包含特殊字符")
+	}
+
+	lower := strings.ToLower(password)
+	if utils.IsInArray(lower, defaultPasswordDenylist) || utils.IsInArray(lower, lowerAll(policy.Denylist)) {
+		addError("密码过于常见，请更换")
+	}
+
+	if user != nil && p.reused(user, password, policy.History) {
+		addError("不能使用最近%d次使用过的密码", policy.History)
+	}
+
+	if len(fields) > 0 {
+		return &PolicyError{Fields: fields}
+	}
+	return nil
+}
+
+// ValidateConfirm 校验两次输入的密码是否一致
+func (p PasswordPolicyImpl) ValidateConfirm(field, password, confirm string) error {
+	if password != confirm {
+		return &PolicyError{Fields: []dto.FieldError{{Field: field, Message: "两次输入的密码不一致"}}}
+	}
+	return nil
+}
+
+// Expired 密码是否超过最长使用天数，从未记录修改时间的密码及外部账户视为未过期
+func (p PasswordPolicyImpl) Expired(user *dto.User) bool {
+	policy := p.policy()
+	if policy.MaxAge <= 0 || user.PasswordUpdatedAt == nil || !User.IsLocal(user) {
+		return false
+	}
+	return time.Since(*user.PasswordUpdatedAt) > time.Duration(policy.MaxAge)*24*time.Hour
+}
+
+// reused 新密码是否与当前密码或最近history次的历史密码相同
+func (p PasswordPolicyImpl) reused(user *dto.User, password string, history int) bool {
+	if history <= 0 {
+		return false
+	}
+	if ok, _ := utils.VerifyPassword(password, user.Salt, user.Password); ok {
+		return true
+	}
+
+	var records []dto.PasswordHistory
+	utils.Db.DB.Where("user_id = ?", user.ID).Order("id DESC").Limit(history - 1).Find(&records)
+	for _, record := range records {
+		if ok, _ := utils.VerifyPassword(password, "", record.Password); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHistory 修改密码前保存旧密码哈希，只保留策略需要的条数
+func (p PasswordPolicyImpl) recordHistory(tx *gorm.DB, userId int64, oldHash string) error {
+	history := p.policy().History
+	if history <= 1 || !strings.HasPrefix(oldHash, "$") {
+		// 旧格式哈希依赖单独的salt，不写入历史
+		return nil
+	}
+	if err := tx.Create(&dto.PasswordHistory{UserID: userId, Password: oldHash}).Error; err != nil {
+		return err
+	}
+
+	var keepIds []int64
+	tx.Model(&dto.PasswordHistory{}).Where("user_id = ?", userId).Order("id DESC").Limit(history-1).Pluck("id", &keepIds)
+	return tx.Where("user_id = ? AND id NOT IN ?", userId, keepIds).Delete(&dto.PasswordHistory{}).Error
+}
+
+func lowerAll(values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = strings.ToLower(value)
+	}
+	return result
+}
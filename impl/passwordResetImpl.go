@@ -0,0 +1,139 @@
+package impl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+	"tiny-admin-api-serve/utils/mailer"
+)
+
+const (
+	defaultResetTokenTTL = 30 * time.Minute // 未配置时重置令牌的有效期
+	resetRequestInterval = 60               // 同一邮箱两次找回请求的最小间隔（秒）
+)
+
+var errInvalidResetToken = errors.New("reset token is invalid or expired")
+
+type PasswordResetImpl struct {
+}
+
+var PasswordReset = PasswordResetImpl{}
+
+// Request 为邮箱对应的用户生成一次性重置令牌并发送邮件
+// 邮箱不存在、非本地账户或请求过于频繁时静默返回，避免泄露账户是否存在
+func (p PasswordResetImpl) Request(email string) error {
+	var user dto.User
+	// 外部账户的密码由身份提供方管理，不能在本系统找回
+	if err := User.FindByEmail(email, &user); err != nil || !User.IsLocal(&user) {
+		return nil
+	}
+	ctx := context.Background()
+	if !utils.Redis.SetStrNotExist(ctx, resetThrottleKey(user.ID), "1", resetRequestInterval) {
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	ttl := p.tokenTTL()
+	if err := utils.Redis.SetStr(ctx, resetTokenKey(token), strconv.FormatInt(user.ID, 10), ttl); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("您好 %s：\n\n我们收到了重置您账户密码的请求，请在%d分钟内打开以下链接设置新密码：\n\n%s\n\n链接只能使用一次。如果这不是您本人的操作，请忽略此邮件，您的密码不会被修改。\n",
+		user.Name, int(ttl.Minutes()), p.resetLink(token))
+	if err := mailer.Send(user.Email, "重置密码", body); err != nil {
+		log.Printf("send password reset mail to %s failed: %v", user.Email, err)
+		return err
+	}
+	return nil
+}
+
+// Reset 校验重置令牌并设置新密码，令牌只能成功使用一次，返回被重置的用户ID
+func (p PasswordResetImpl) Reset(body dto.ResetPasswordBody) (int64, error) {
+	ctx := context.Background()
+	key := resetTokenKey(body.Token)
+	value, err := utils.Redis.GetStr(ctx, key)
+	if err != nil {
+		return 0, errInvalidResetToken
+	}
+	userId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errInvalidResetToken
+	}
+	var user dto.User
+	if err := User.FindById(userId, &user); err != nil {
+		return 0, errInvalidResetToken
+	}
+
+	// 密码不符合策略时不消耗令牌，用户可以修改后重试
+	if err := PasswordPolicy.ValidateConfirm("confirmNewPassword", body.NewPassword, body.ConfirmNewPassword); err != nil {
+		return 0, err
+	}
+	if err := PasswordPolicy.Validate("newPassword", body.NewPassword, &user); err != nil {
+		return 0, err
+	}
+
+	// 原子地取出并删除令牌，并发请求只有一个能成功
+	if _, err := utils.Redis.GetDel(ctx, key); err != nil {
+		return 0, errInvalidResetToken
+	}
+	if err := User.savePassword(user, body.NewPassword); err != nil {
+		return 0, err
+	}
+	// 成功重置后解除账户的登录锁定并清除失败次数；密码已修改，解除失败只记录日志，管理员可以手动解除
+	if err := LoginLock.Unlock(user.Email, ""); err != nil {
+		log.Printf("unlock login of user %d after password reset failed: %v", user.ID, err)
+	}
+	return user.ID, nil
+}
+
+func (p PasswordResetImpl) tokenTTL() time.Duration {
+	if setting.Conf.PasswordReset != nil && setting.Conf.PasswordReset.TokenTTL > 0 {
+		return time.Duration(setting.Conf.PasswordReset.TokenTTL) * time.Minute
+	}
+	return defaultResetTokenTTL
+}
+
+// resetLink 拼接邮件中的重置链接，未配置url时直接返回令牌
+func (p PasswordResetImpl) resetLink(token string) string {
+	if setting.Conf.PasswordReset == nil {
+		return token
+	}
+	return appendQuery(setting.Conf.PasswordReset.URL, "token", token)
+}
+
+// appendQuery 将令牌等参数附加到前端页面地址后（兼容hash路由），地址为空时直接返回参数值
+func appendQuery(link, key, value string) string {
+	if link == "" {
+		return value
+	}
+	separator := "?"
+	if u, err := url.Parse(link); err == nil && (u.RawQuery != "" || strings.Contains(u.Fragment, "?")) {
+		separator = "&"
+	}
+	return link + separator + key + "=" + url.QueryEscape(value)
+}
+
+func resetTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("pwd_reset:%s", hex.EncodeToString(sum[:]))
+}
+
+func resetThrottleKey(userId int64) string {
+	return fmt.Sprintf("pwd_reset_throttle:%d", userId)
+}
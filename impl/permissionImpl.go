@@ -2,6 +2,8 @@ package impl
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"tiny-admin-api-serve/entity/dto"
 	"tiny-admin-api-serve/utils"
 )
@@ -42,6 +44,8 @@ func (p PermissionImpl) Create(createPermissionDto dto.Permission, isInit bool)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	// 新权限可能被已授予的通配符权限覆盖
+	Profile.InvalidateAll()
 
 	permissionVo := &dto.Permission{
 		ID:   newPermission.ID,
@@ -67,6 +71,7 @@ func (p PermissionImpl) UpdatePermission(updatePermissionDto dto.Permission) (*d
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	Profile.InvalidateAll()
 
 	permissionVo := &dto.Permission{
 		ID:   permission.ID,
@@ -139,6 +144,7 @@ func (p PermissionImpl) DelPermission(id int) (*dto.Permission, error) {
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	Profile.InvalidateAll()
 
 	createPermissionDto := &dto.Permission{
 		Name: permission.Name,
@@ -157,3 +163,124 @@ func (p PermissionImpl) FindAllPermission() ([]dto.Permission, error) {
 	}
 	return permissions, nil
 }
+
+// FindNamesByUserId 根据用户ID查询其通过角色获得的全部权限名称，包含继承自上级角色的权限
+func (p PermissionImpl) FindNamesByUserId(userId int64) ([]string, error) {
+	var roleIds []int64
+	if err := utils.Db.DB.Table("user_role").Where("user_id = ?", userId).Pluck("role_id", &roleIds).Error; err != nil {
+		return nil, err
+	}
+	roleIds, err := Role.WithAncestors(roleIds)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	if len(roleIds) == 0 {
+		return names, nil
+	}
+
+	result := utils.Db.DB.Model(&dto.Permission{}).
+		Distinct().
+		Joins("JOIN role_permission ON permission.id = role_permission.permission_id").
+		Where("role_permission.role_id IN ?", roleIds).
+		Pluck("permission.name", &names)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return names, nil
+}
+
+// Expand 将权限模式展开为当前存在的、被它覆盖的全部具体权限（不含通配符权限）
+func (p PermissionImpl) Expand(pattern string) ([]dto.Permission, error) {
+	permissions, err := p.FindAllPermission()
+	if err != nil {
+		return nil, err
+	}
+	result := []dto.Permission{}
+	for _, permission := range permissions {
+		if !utils.IsWildcardPermission(permission.Name) && utils.MatchPermission(pattern, permission.Name) {
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+// ExpandNames 返回拥有的权限及其通配符覆盖的全部具体权限名称，供前端按具体权限编码判断
+func (p PermissionImpl) ExpandNames(owned []string) ([]string, error) {
+	result := append([]string{}, owned...)
+	hasWildcard := false
+	for _, name := range owned {
+		if utils.IsWildcardPermission(name) {
+			hasWildcard = true
+			break
+		}
+	}
+	if !hasWildcard {
+		return result, nil
+	}
+
+	permissions, err := p.FindAllPermission()
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range permissions {
+		if !utils.IsInArray(permission.Name, result) && utils.HasPermission(owned, permission.Name) {
+			result = append(result, permission.Name)
+		}
+	}
+	return result, nil
+}
+
+// Sync 按路由所需的权限同步权限表，required为权限编码到描述的映射
+// 缺少的权限以初始化模式创建，adminRole不为空时将新建的权限授予该角色
+func (p PermissionImpl) Sync(required map[string]string, adminRole string) (*dto.PermissionSyncVo, error) {
+	permissions, err := p.FindAllPermission()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		existing[permission.Name] = true
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &dto.PermissionSyncVo{Created: []string{}, Orphaned: []string{}, Granted: []string{}}
+	var created []dto.Permission
+	for _, name := range names {
+		if existing[name] {
+			continue
+		}
+		permission, err := p.Create(dto.Permission{Name: name, Desc: required[name]}, true)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, *permission)
+		result.Created = append(result.Created, name)
+	}
+	for _, permission := range permissions {
+		if _, ok := required[permission.Name]; !ok && !utils.IsWildcardPermission(permission.Name) {
+			result.Orphaned = append(result.Orphaned, permission.Name)
+		}
+	}
+
+	if adminRole == "" || len(created) == 0 {
+		return result, nil
+	}
+	var role dto.Role
+	if err := utils.Db.DB.Where("name = ?", adminRole).First(&role).Error; err != nil {
+		return nil, fmt.Errorf("admin role %s not found", adminRole)
+	}
+	if err := utils.Db.DB.Model(&role).Association("Permissions").Append(created); err != nil {
+		return nil, err
+	}
+	Profile.InvalidateRoles(role.ID)
+	result.Granted = result.Created
+	return result, nil
+}
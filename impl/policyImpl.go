@@ -0,0 +1,523 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/policyEffect"
+	"tiny-admin-api-serve/utils"
+)
+
+// ErrPolicyDenied 操作被访问策略拒绝
+var ErrPolicyDenied = errors.New("operation denied by policy")
+
+const policyReloadInterval = 30 * time.Second // 策略缓存的有效期，过期后从MySQL重新加载；集群部署时修改策略会通知其他节点立即重新加载
+
+// 策略条件支持的运算符
+const (
+	policyOpEq       = "eq"
+	policyOpNeq      = "neq"
+	policyOpIn       = "in"
+	policyOpNotIn    = "not_in"
+	policyOpGt       = "gt"
+	policyOpGte      = "gte"
+	policyOpLt       = "lt"
+	policyOpLte      = "lte"
+	policyOpBetween  = "between"  // 值为[最小值, 最大值]，包含边界
+	policyOpContains = "contains" // 属性为列表（如subject.roles）时包含指定值
+	policyOpCidr     = "cidr"     // IP属于指定网段，值可以是单个网段或列表
+)
+
+// policyResourceActions 业务方法传入资源属性调用Enforce的操作，只有这些操作的策略可以使用资源条件；
+// 其他操作只在中间件中判断，没有资源属性，包含资源条件的策略不会生效
+var policyResourceActions = []string{"user::update", "user::remove", "user::batch-remove", "user::assign-role"}
+
+var policyOperators = []string{policyOpEq, policyOpNeq, policyOpIn, policyOpNotIn, policyOpGt, policyOpGte,
+	policyOpLt, policyOpLte, policyOpBetween, policyOpContains, policyOpCidr}
+
+// ErrPermissionDenied 操作者缺少业务方法所需的权限
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Operator 发起操作的用户及请求环境，用于数据范围过滤和策略判断；为nil时表示系统内部调用，不做限制
+type Operator struct {
+	UserId       int64
+	Ip           string
+	Scope        *UserDataScope
+	ApiKeyScopes []string               // 通过API密钥访问时密钥的scopes，否则为nil
+	subject      map[string]interface{} // 主体属性，同一请求内只加载一次
+	roleIds      map[int64]bool         // 拥有的角色（含继承的上级角色），同一请求内只加载一次
+}
+
+// DataScope 操作者的数据范围
+func (o *Operator) DataScope() *UserDataScope {
+	if o == nil {
+		return nil
+	}
+	return o.Scope
+}
+
+// HasPermission 操作者是否拥有权限，通过API密钥访问时权限还必须在密钥的scopes内
+func (o *Operator) HasPermission(permission string) (bool, error) {
+	if o == nil {
+		return true, nil
+	}
+	owned, err := Profile.Permissions(o.UserId)
+	if err != nil {
+		return false, err
+	}
+	if o.ApiKeyScopes != nil && !utils.HasPermission(o.ApiKeyScopes, permission) {
+		return false, nil
+	}
+	return utils.HasPermission(owned, permission), nil
+}
+
+// HasMenu 操作者是否可以看到菜单；拥有menu::update权限的操作者可以修改全部菜单，视为全部可见
+func (o *Operator) HasMenu(menuId int64) (bool, error) {
+	if o == nil {
+		return true, nil
+	}
+	manager, err := o.HasPermission("menu::update")
+	if err != nil || manager {
+		return manager, err
+	}
+	menus, err := Profile.Menus(o.UserId)
+	if err != nil {
+		return false, err
+	}
+	return containsMenuVo(menus, menuId), nil
+}
+
+// containsMenuVo 菜单树中是否包含指定菜单
+func containsMenuVo(menus []dto.MenuVo, menuId int64) bool {
+	for _, menu := range menus {
+		if menu.ID == menuId || (menu.Children != nil && containsMenuVo(*menu.Children, menuId)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsRole 操作者是否拥有角色，包含通过上级角色继承的角色
+func (o *Operator) HoldsRole(roleId int64) (bool, error) {
+	if o == nil {
+		return true, nil
+	}
+	if o.roleIds == nil {
+		var direct []int64
+		if err := utils.Db.DB.Table("user_role").Where("user_id = ?", o.UserId).Pluck("role_id", &direct).Error; err != nil {
+			return false, err
+		}
+		ids, err := Role.WithAncestors(direct)
+		if err != nil {
+			return false, err
+		}
+		o.roleIds = make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			o.roleIds[id] = true
+		}
+	}
+	return o.roleIds[roleId], nil
+}
+
+// policyCache 内存中的策略，过期或本节点修改策略后重新加载
+var policyCache struct {
+	sync.RWMutex
+	policies []dto.Policy
+	loadedAt time.Time
+}
+
+type PolicyImpl struct {
+}
+
+var Policy = PolicyImpl{}
+
+// Enforce 判断操作者能否对资源执行操作，action为权限编码，resource为资源属性（不带resource.前缀）
+// 适用于该操作的策略中，任一deny策略条件全部满足时拒绝；存在allow策略时必须满足其中之一；没有适用的策略时允许
+// resource为nil时（如在中间件中）跳过包含资源条件的策略，由业务方法传入资源属性后再判断，这类策略只能用于policyResourceActions中的操作
+func (p PolicyImpl) Enforce(operator *Operator, action string, resource map[string]interface{}) error {
+	if operator == nil {
+		return nil
+	}
+	var applicable []dto.Policy
+	for _, policy := range p.policies() {
+		if !policy.Disabled && utils.HasPermission(policy.Actions, action) {
+			applicable = append(applicable, policy)
+		}
+	}
+	if len(applicable) == 0 {
+		return nil
+	}
+
+	attributes, err := p.attributes(operator, resource)
+	if err != nil {
+		return err
+	}
+	hasAllow, allowed := false, false
+	for _, policy := range applicable {
+		if resource == nil && referencesResource(policy) {
+			// 资源条件留到业务方法中判断，此处不能因缺少allow而拒绝
+			if policy.Effect == policyEffect.Allow {
+				allowed = true
+			}
+			continue
+		}
+		matched := p.matches(policy.Conditions, attributes)
+		switch policy.Effect {
+		case policyEffect.Deny:
+			if matched {
+				return ErrPolicyDenied
+			}
+		case policyEffect.Allow:
+			hasAllow = true
+			allowed = allowed || matched
+		}
+	}
+	if hasAllow && !allowed {
+		return ErrPolicyDenied
+	}
+	return nil
+}
+
+// UserResource 用户作为资源时的属性
+func (p PolicyImpl) UserResource(user *dto.User) map[string]interface{} {
+	resource := map[string]interface{}{
+		"id":         user.ID,
+		"email":      user.Email,
+		"department": user.Department,
+		"status":     user.Status,
+		"provider":   user.Provider,
+	}
+	if user.DeptId != nil {
+		resource["deptId"] = *user.DeptId
+	}
+	return resource
+}
+
+// List 查询全部策略
+func (p PolicyImpl) List() ([]dto.Policy, error) {
+	var policies []dto.Policy
+	if err := utils.Db.DB.Order("id ASC").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// CreatePolicy 创建策略，立即生效
+func (p PolicyImpl) CreatePolicy(policy dto.Policy) (*dto.Policy, error) {
+	if err := p.validate(policy); err != nil {
+		return nil, err
+	}
+	policy.ID = 0
+	if err := utils.Db.DB.Create(&policy).Error; err != nil {
+		return nil, err
+	}
+	p.reload()
+	publishCacheEvict(cacheEvictMessage{Policies: true})
+	return &policy, nil
+}
+
+// UpdatePolicy 更新策略，立即生效
+func (p PolicyImpl) UpdatePolicy(updatePolicy dto.Policy) (*dto.Policy, error) {
+	var policy dto.Policy
+	if err := utils.Db.DB.Where("id = ?", updatePolicy.ID).First(&policy).Error; err != nil {
+		return nil, errors.New("policy not found")
+	}
+	if err := p.validate(updatePolicy); err != nil {
+		return nil, err
+	}
+
+	policy.Name = updatePolicy.Name
+	policy.Description = updatePolicy.Description
+	policy.Effect = updatePolicy.Effect
+	policy.Actions = updatePolicy.Actions
+	policy.Conditions = updatePolicy.Conditions
+	policy.Disabled = updatePolicy.Disabled
+	if err := utils.Db.DB.Save(&policy).Error; err != nil {
+		return nil, err
+	}
+	p.reload()
+	publishCacheEvict(cacheEvictMessage{Policies: true})
+	return &policy, nil
+}
+
+// DeletePolicy 删除策略，立即生效
+func (p PolicyImpl) DeletePolicy(id int64) (*dto.Policy, error) {
+	var policy dto.Policy
+	if err := utils.Db.DB.Where("id = ?", id).First(&policy).Error; err != nil {
+		return nil, errors.New("policy not found")
+	}
+	if err := utils.Db.DB.Delete(&policy).Error; err != nil {
+		return nil, err
+	}
+	p.reload()
+	publishCacheEvict(cacheEvictMessage{Policies: true})
+	return &policy, nil
+}
+
+// policies 获取内存中的策略，超过重新加载间隔时从MySQL重新加载
+func (p PolicyImpl) policies() []dto.Policy {
+	policyCache.RLock()
+	policies, loadedAt := policyCache.policies, policyCache.loadedAt
+	policyCache.RUnlock()
+	if time.Since(loadedAt) < policyReloadInterval {
+		return policies
+	}
+	return p.reload()
+}
+
+// reload 从MySQL重新加载策略，加载失败时继续使用已加载的策略
+func (p PolicyImpl) reload() []dto.Policy {
+	policyCache.Lock()
+	defer policyCache.Unlock()
+	policies, err := p.List()
+	if err != nil {
+		log.Printf("failed to reload policies: %v", err)
+		return policyCache.policies
+	}
+	policyCache.policies = policies
+	policyCache.loadedAt = time.Now()
+	return policies
+}
+
+// validate 校验策略的效果、操作和条件
+func (p PolicyImpl) validate(policy dto.Policy) error {
+	if policy.Effect != policyEffect.Allow && policy.Effect != policyEffect.Deny {
+		return errors.New("invalid policy effect")
+	}
+	if len(policy.Actions) == 0 {
+		return errors.New("policy requires at least one action")
+	}
+	if referencesResource(policy) {
+		for _, action := range policy.Actions {
+			if !utils.IsInArray(action, policyResourceActions) {
+				return fmt.Errorf("action %s does not support resource conditions, supported actions: %s",
+					action, strings.Join(policyResourceActions, ", "))
+			}
+		}
+	}
+	for _, condition := range policy.Conditions {
+		if !strings.HasPrefix(condition.Attribute, "subject.") && !strings.HasPrefix(condition.Attribute, "resource.") &&
+			!strings.HasPrefix(condition.Attribute, "env.") {
+			return fmt.Errorf("invalid condition attribute %q", condition.Attribute)
+		}
+		if !utils.IsInArray(condition.Operator, policyOperators) {
+			return fmt.Errorf("invalid condition operator %q", condition.Operator)
+		}
+		if condition.Operator == policyOpBetween && len(toList(condition.Value)) != 2 {
+			return errors.New("between requires a [min, max] value")
+		}
+		if condition.Operator == policyOpCidr {
+			for _, cidr := range toList(condition.Value) {
+				if _, _, err := net.ParseCIDR(fmt.Sprint(cidr)); err != nil {
+					return fmt.Errorf("invalid cidr %v", cidr)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// attributes 收集主体、资源和环境属性
+func (p PolicyImpl) attributes(operator *Operator, resource map[string]interface{}) (map[string]interface{}, error) {
+	if operator.subject == nil {
+		subject, err := p.subject(operator.UserId)
+		if err != nil {
+			return nil, err
+		}
+		operator.subject = subject
+	}
+
+	attributes := make(map[string]interface{}, len(operator.subject)+len(resource)+5)
+	for key, value := range operator.subject {
+		attributes["subject."+key] = value
+	}
+	for key, value := range resource {
+		attributes["resource."+key] = value
+	}
+	now := time.Now()
+	attributes["env.ip"] = operator.Ip
+	attributes["env.time"] = now.Format("15:04")
+	attributes["env.hour"] = now.Hour()
+	attributes["env.weekday"] = int(now.Weekday())
+	attributes["env.date"] = now.Format("2006-01-02")
+	return attributes, nil
+}
+
+// subject 加载主体属性，角色包含继承的上级角色
+func (p PolicyImpl) subject(userId int64) (map[string]interface{}, error) {
+	var user dto.User
+	if err := utils.Db.DB.Preload("Roles").Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	roleIds := make([]int64, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roleIds = append(roleIds, role.ID)
+	}
+	roleIds, err := Role.WithAncestors(roleIds)
+	if err != nil {
+		return nil, err
+	}
+	roles := []string{}
+	if len(roleIds) > 0 {
+		if err := utils.Db.DB.Model(&dto.Role{}).Where("id IN ?", roleIds).Pluck("name", &roles).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	subject := map[string]interface{}{
+		"id":         user.ID,
+		"email":      user.Email,
+		"department": user.Department,
+		"roles":      roles,
+	}
+	if user.DeptId != nil {
+		subject["deptId"] = *user.DeptId
+	}
+	return subject, nil
+}
+
+// matches 条件是否全部满足
+func (p PolicyImpl) matches(conditions []dto.PolicyCondition, attributes map[string]interface{}) bool {
+	for _, condition := range conditions {
+		if !p.check(condition, attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+// check 判断单个条件
+// 不存在的属性不等于任何值：neq、not_in成立，其他运算符不成立，因此"不属于某部门"的deny策略对没有部门的用户同样生效
+func (p PolicyImpl) check(condition dto.PolicyCondition, attributes map[string]interface{}) bool {
+	actual, ok := attributes[condition.Attribute]
+	if !ok || actual == nil {
+		return condition.Operator == policyOpNeq || condition.Operator == policyOpNotIn
+	}
+	expected := resolveValue(condition.Value, attributes)
+
+	switch condition.Operator {
+	case policyOpEq:
+		return sameValue(actual, expected)
+	case policyOpNeq:
+		return !sameValue(actual, expected)
+	case policyOpIn:
+		return containsValue(toList(expected), actual)
+	case policyOpNotIn:
+		return !containsValue(toList(expected), actual)
+	case policyOpGt:
+		return compareValue(actual, expected) > 0
+	case policyOpGte:
+		return compareValue(actual, expected) >= 0
+	case policyOpLt:
+		return compareValue(actual, expected) < 0
+	case policyOpLte:
+		return compareValue(actual, expected) <= 0
+	case policyOpBetween:
+		bounds := toList(expected)
+		return len(bounds) == 2 && compareValue(actual, bounds[0]) >= 0 && compareValue(actual, bounds[1]) <= 0
+	case policyOpContains:
+		return containsValue(toList(actual), expected)
+	case policyOpCidr:
+		ip := net.ParseIP(fmt.Sprint(actual))
+		if ip == nil {
+			return false
+		}
+		for _, cidr := range toList(expected) {
+			if _, network, err := net.ParseCIDR(fmt.Sprint(cidr)); err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// referencesResource 策略是否包含资源条件
+func referencesResource(policy dto.Policy) bool {
+	for _, condition := range policy.Conditions {
+		if strings.HasPrefix(condition.Attribute, "resource.") {
+			return true
+		}
+		for _, value := range toList(condition.Value) {
+			if reference, ok := value.(string); ok && strings.HasPrefix(reference, "${resource.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveValue 将"${属性}"形式的引用替换为属性值，列表中的引用逐个替换
+func resolveValue(value interface{}, attributes map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "${") && strings.HasSuffix(v, "}") {
+			return attributes[v[2:len(v)-1]]
+		}
+		return v
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved[i] = resolveValue(item, attributes)
+		}
+		return resolved
+	}
+	return value
+}
+
+// toList 将列表属性或单个值统一为列表
+func toList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return list
+	}
+	return []interface{}{value}
+}
+
+// sameValue 按字符串形式比较，JSON中的数字与整型属性可以直接比较
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if sameValue(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValue 两个值都是数字时按数值比较，否则按字符串比较（"09:00"等时间格式可直接比较）
+func compareValue(a, b interface{}) int {
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+	af, aErr := strconv.ParseFloat(as, 64)
+	bf, bErr := strconv.ParseFloat(bs, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(as, bs)
+}
@@ -0,0 +1,171 @@
+package impl
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/policyEffect"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	// 条件值按JSON反序列化后的类型给出：数字为float64，列表为[]interface{}
+	attributes := map[string]interface{}{
+		"subject.id":          int64(7),
+		"subject.department":  "sales",
+		"subject.deptId":      int64(3),
+		"subject.roles":       []string{"admin", "auditor"},
+		"resource.department": "sales",
+		"resource.deptId":     int64(4),
+		"resource.status":     1,
+		"env.ip":              "10.1.2.3",
+		"env.time":            "09:30",
+		"env.hour":            9,
+	}
+	tests := []struct {
+		name      string
+		condition dto.PolicyCondition
+		want      bool
+	}{
+		{name: "eq", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "eq", Value: "sales"}, want: true},
+		{name: "eq mismatch", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "eq", Value: "hr"}, want: false},
+		{name: "eq number", condition: dto.PolicyCondition{Attribute: "subject.deptId", Operator: "eq", Value: float64(3)}, want: true},
+		{name: "eq reference", condition: dto.PolicyCondition{Attribute: "resource.department", Operator: "eq", Value: "${subject.department}"}, want: true},
+		{name: "eq reference mismatch", condition: dto.PolicyCondition{Attribute: "resource.deptId", Operator: "eq", Value: "${subject.deptId}"}, want: false},
+		{name: "eq missing reference", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "eq", Value: "${subject.missing}"}, want: false},
+		{name: "neq", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "neq", Value: "hr"}, want: true},
+		{name: "neq reference", condition: dto.PolicyCondition{Attribute: "resource.deptId", Operator: "neq", Value: "${subject.deptId}"}, want: true},
+		{name: "in", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "in", Value: []interface{}{"hr", "sales"}}, want: true},
+		{name: "in mismatch", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "in", Value: []interface{}{"hr", "it"}}, want: false},
+		{name: "in with reference", condition: dto.PolicyCondition{Attribute: "resource.deptId", Operator: "in", Value: []interface{}{"${subject.deptId}", float64(4)}}, want: true},
+		{name: "not_in", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "not_in", Value: []interface{}{"hr", "it"}}, want: true},
+		{name: "not_in mismatch", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "not_in", Value: []interface{}{"sales"}}, want: false},
+		{name: "gt", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "gt", Value: float64(8)}, want: true},
+		{name: "gt equal", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "gt", Value: float64(9)}, want: false},
+		{name: "gte", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "gte", Value: float64(9)}, want: true},
+		{name: "lt", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "lt", Value: float64(9)}, want: false},
+		{name: "lt numeric not lexical", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "lt", Value: float64(10)}, want: true},
+		{name: "lte", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "lte", Value: float64(8)}, want: false},
+		{name: "between time", condition: dto.PolicyCondition{Attribute: "env.time", Operator: "between", Value: []interface{}{"09:00", "18:00"}}, want: true},
+		{name: "between outside", condition: dto.PolicyCondition{Attribute: "env.time", Operator: "between", Value: []interface{}{"10:00", "18:00"}}, want: false},
+		{name: "between bad bounds", condition: dto.PolicyCondition{Attribute: "env.hour", Operator: "between", Value: float64(9)}, want: false},
+		{name: "contains", condition: dto.PolicyCondition{Attribute: "subject.roles", Operator: "contains", Value: "auditor"}, want: true},
+		{name: "contains mismatch", condition: dto.PolicyCondition{Attribute: "subject.roles", Operator: "contains", Value: "guest"}, want: false},
+		{name: "cidr", condition: dto.PolicyCondition{Attribute: "env.ip", Operator: "cidr", Value: "10.0.0.0/8"}, want: true},
+		{name: "cidr list", condition: dto.PolicyCondition{Attribute: "env.ip", Operator: "cidr", Value: []interface{}{"192.168.0.0/16", "10.1.0.0/16"}}, want: true},
+		{name: "cidr mismatch", condition: dto.PolicyCondition{Attribute: "env.ip", Operator: "cidr", Value: "192.168.0.0/16"}, want: false},
+		{name: "cidr invalid network", condition: dto.PolicyCondition{Attribute: "env.ip", Operator: "cidr", Value: "not-a-cidr"}, want: false},
+		{name: "unknown operator", condition: dto.PolicyCondition{Attribute: "subject.department", Operator: "like", Value: "sales"}, want: false},
+		{name: "missing eq", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "eq", Value: "sales"}, want: false},
+		{name: "missing in", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "in", Value: []interface{}{"sales"}}, want: false},
+		{name: "missing gt", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "gt", Value: float64(0)}, want: false},
+		{name: "missing contains", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "contains", Value: "admin"}, want: false},
+		{name: "missing neq", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "neq", Value: "sales"}, want: true},
+		{name: "missing not_in", condition: dto.PolicyCondition{Attribute: "subject.missing", Operator: "not_in", Value: []interface{}{"sales"}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Policy.check(tt.condition, attributes); got != tt.want {
+				t.Errorf("check(%+v) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEnforce(t *testing.T) {
+	inSales := dto.PolicyCondition{Attribute: "subject.department", Operator: "eq", Value: "sales"}
+	inHr := dto.PolicyCondition{Attribute: "subject.department", Operator: "eq", Value: "hr"}
+	sameDept := dto.PolicyCondition{Attribute: "resource.department", Operator: "eq", Value: "${subject.department}"}
+	policy := func(effect string, actions []string, conditions ...dto.PolicyCondition) dto.Policy {
+		return dto.Policy{Effect: effect, Actions: actions, Conditions: conditions}
+	}
+
+	tests := []struct {
+		name     string
+		policies []dto.Policy
+		action   string
+		resource map[string]interface{}
+		want     error
+	}{
+		{name: "no policies", action: "user::remove"},
+		{name: "policy for another action", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"role::remove"}, inSales),
+		}, action: "user::remove"},
+		{name: "matching deny", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"user::remove"}, inSales),
+		}, action: "user::remove", want: ErrPolicyDenied},
+		{name: "deny with wildcard action", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"user::*"}, inSales),
+		}, action: "user::remove", want: ErrPolicyDenied},
+		{name: "unmatched deny", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"user::remove"}, inHr),
+		}, action: "user::remove"},
+		{name: "disabled deny", policies: []dto.Policy{
+			{Effect: policyEffect.Deny, Actions: []string{"user::remove"}, Conditions: []dto.PolicyCondition{inSales}, Disabled: true},
+		}, action: "user::remove"},
+		{name: "matching allow", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, inSales),
+		}, action: "user::remove"},
+		{name: "unmatched allow", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, inHr),
+		}, action: "user::remove", want: ErrPolicyDenied},
+		{name: "one of several allows", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, inHr),
+			policy(policyEffect.Allow, []string{"user::remove"}, inSales),
+		}, action: "user::remove"},
+		{name: "deny overrides allow", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, inSales),
+			policy(policyEffect.Deny, []string{"user::remove"}, inSales),
+		}, action: "user::remove", want: ErrPolicyDenied},
+		{name: "unmatched deny keeps allow", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, inSales),
+			policy(policyEffect.Deny, []string{"user::remove"}, inHr),
+		}, action: "user::remove"},
+		{name: "resource allow deferred without resource", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, sameDept),
+		}, action: "user::remove"},
+		{name: "resource deny deferred without resource", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"user::remove"}, sameDept),
+		}, action: "user::remove"},
+		{name: "resource allow matched", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, sameDept),
+		}, action: "user::remove", resource: map[string]interface{}{"department": "sales"}},
+		{name: "resource allow unmatched", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, sameDept),
+		}, action: "user::remove", resource: map[string]interface{}{"department": "hr"}, want: ErrPolicyDenied},
+		{name: "resource deny matched", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"user::remove"}, sameDept),
+		}, action: "user::remove", resource: map[string]interface{}{"department": "sales"}, want: ErrPolicyDenied},
+		{name: "resource attribute missing fails closed", policies: []dto.Policy{
+			policy(policyEffect.Allow, []string{"user::remove"}, sameDept),
+		}, action: "user::remove", resource: map[string]interface{}{}, want: ErrPolicyDenied},
+		{name: "env condition", policies: []dto.Policy{
+			policy(policyEffect.Deny, []string{"*"}, dto.PolicyCondition{Attribute: "env.ip", Operator: "cidr", Value: "10.0.0.0/8"}),
+		}, action: "dept::query", want: ErrPolicyDenied},
+	}
+
+	defer func(policies []dto.Policy, loadedAt time.Time) {
+		policyCache.policies, policyCache.loadedAt = policies, loadedAt
+	}(policyCache.policies, policyCache.loadedAt)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 预置策略缓存和主体属性，避免访问数据库
+			policyCache.policies, policyCache.loadedAt = tt.policies, time.Now()
+			operator := &Operator{
+				UserId:  7,
+				Ip:      "10.1.2.3",
+				subject: map[string]interface{}{"id": int64(7), "department": "sales", "roles": []string{"admin"}},
+			}
+			if err := Policy.Enforce(operator, tt.action, tt.resource); !errors.Is(err, tt.want) {
+				t.Errorf("Enforce() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("nil operator", func(t *testing.T) {
+		policyCache.policies, policyCache.loadedAt = []dto.Policy{policy(policyEffect.Deny, []string{"*"})}, time.Now()
+		if err := Policy.Enforce(nil, "user::remove", nil); err != nil {
+			t.Errorf("Enforce(nil) error = %v, want nil", err)
+		}
+	})
+}
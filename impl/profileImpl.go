@@ -0,0 +1,221 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/utils"
+)
+
+const (
+	profileCacheTTL = 30 * time.Minute // Redis中缓存的角色、权限和菜单有效期
+	profileLocalTTL = time.Minute      // 进程内缓存的有效期，集群部署时即使错过失效消息也最多在此时间后更新
+)
+
+// profileCache 按用户缓存的角色名称、权限编码和菜单树
+type profileCache struct {
+	Roles       []string     `json:"roles"`
+	Grants      []string     `json:"grants"`      // 有效权限（含继承和通配符），用于权限校验
+	Permissions []string     `json:"permissions"` // 通配符展开后的具体权限，返回给前端
+	Menus       []dto.MenuVo `json:"menus"`
+}
+
+// localProfile 进程内缓存的资料
+type localProfile struct {
+	cache    *profileCache
+	expireAt time.Time
+}
+
+// localProfiles 进程内缓存，先于Redis读取，避免每次权限校验都访问Redis
+var localProfiles = struct {
+	sync.RWMutex
+	entries map[int64]localProfile
+}{entries: map[int64]localProfile{}}
+
+// ProfileImpl 当前登录用户的资料，角色、权限和菜单按用户缓存在进程内和Redis中，角色、权限、菜单或用户角色变化时失效
+// 集群部署时通过Redis发布订阅通知其他节点清除进程内缓存
+type ProfileImpl struct {
+}
+
+var Profile = ProfileImpl{}
+
+// Get 获取用户资料，用户信息每次从数据库读取，角色、权限和菜单优先读取缓存
+func (p ProfileImpl) Get(userId int64) (*dto.ProfileVo, error) {
+	var user dto.User
+	if err := User.FindById(userId, &user); err != nil {
+		return nil, err
+	}
+
+	cache, err := p.cached(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ProfileVo{
+		GetInfo: dto.GetInfo{
+			User:        &user,
+			Roles:       cache.Roles,
+			Permissions: cache.Permissions,
+		},
+		Menus: cache.Menus,
+	}, nil
+}
+
+// Permissions 获取用户的有效权限（含继承自上级角色的权限和通配符权限），用于权限校验
+func (p ProfileImpl) Permissions(userId int64) ([]string, error) {
+	cache, err := p.cached(userId)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Grants, nil
+}
+
+// Menus 获取用户的菜单树
+func (p ProfileImpl) Menus(userId int64) ([]dto.MenuVo, error) {
+	cache, err := p.cached(userId)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Menus, nil
+}
+
+// cached 依次读取进程内缓存、Redis缓存，都未命中时从数据库加载并写入缓存
+func (p ProfileImpl) cached(userId int64) (*profileCache, error) {
+	localProfiles.RLock()
+	entry, ok := localProfiles.entries[userId]
+	localProfiles.RUnlock()
+	if ok && time.Now().Before(entry.expireAt) {
+		return entry.cache, nil
+	}
+
+	ctx := context.Background()
+	cache := &profileCache{}
+	// 旧版本缓存中没有grants，视为未命中
+	if !utils.Redis.KEYEXISTSGetScan(ctx, profileKey(userId), cache) || cache.Grants == nil {
+		loaded, err := p.load(userId)
+		if err != nil {
+			return nil, err
+		}
+		cache = loaded
+		if body, err := json.Marshal(cache); err == nil {
+			if err := utils.Redis.Set(ctx, profileKey(userId), body, profileCacheTTL); err != nil {
+				log.Printf("failed to cache profile of user %d: %v", userId, err)
+			}
+		}
+	}
+
+	localProfiles.Lock()
+	localProfiles.entries[userId] = localProfile{cache: cache, expireAt: time.Now().Add(profileLocalTTL)}
+	localProfiles.Unlock()
+	return cache, nil
+}
+
+// load 从数据库加载用户的角色、权限和菜单
+func (p ProfileImpl) load(userId int64) (*profileCache, error) {
+	var user dto.User
+	if err := utils.Db.DB.Preload("Roles").Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	cache := &profileCache{Roles: []string{}, Grants: []string{}, Permissions: []string{}, Menus: []dto.MenuVo{}}
+	roleIds := make([]int64, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		cache.Roles = append(cache.Roles, role.Name)
+		roleIds = append(roleIds, role.ID)
+	}
+	if len(roleIds) == 0 {
+		return cache, nil
+	}
+
+	grants, err := Permission.FindNamesByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	cache.Grants = append(cache.Grants, grants...)
+	// 通配符权限展开为具体权限，前端可直接按权限编码判断
+	permissions, err := Permission.ExpandNames(grants)
+	if err != nil {
+		return nil, err
+	}
+	cache.Permissions = append(cache.Permissions, permissions...)
+
+	menus, err := Menu.FindMenusByRoleIds(roleIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(menus) > 0 {
+		cache.Menus = Menu.buildMenuTree(menus)
+	}
+	return cache, nil
+}
+
+// Invalidate 清除指定用户的资料缓存，用户角色变化后调用
+func (p ProfileImpl) Invalidate(userIds ...int64) {
+	if len(userIds) == 0 {
+		return
+	}
+	ctx := context.Background()
+	for _, userId := range userIds {
+		if err := utils.Redis.DelByKey(ctx, profileKey(userId)); err != nil {
+			log.Printf("failed to invalidate profile of user %d: %v", userId, err)
+		}
+	}
+	p.evictLocal(userIds...)
+	publishCacheEvict(cacheEvictMessage{UserIds: userIds})
+}
+
+// InvalidateRoles 清除拥有指定角色或其下级角色的全部用户的资料缓存，角色本身或其权限、菜单变化后调用
+func (p ProfileImpl) InvalidateRoles(roleIds ...int64) {
+	if len(roleIds) == 0 {
+		return
+	}
+	roleIds, err := Role.WithDescendants(roleIds)
+	if err != nil {
+		log.Printf("failed to find child roles of %v: %v", roleIds, err)
+		return
+	}
+	var userIds []int64
+	if err := utils.Db.DB.Table("user_role").Where("role_id IN ?", roleIds).Distinct().Pluck("user_id", &userIds).Error; err != nil {
+		log.Printf("failed to find users of roles %v: %v", roleIds, err)
+		return
+	}
+	p.Invalidate(userIds...)
+}
+
+// InvalidateAll 清除全部用户的资料缓存，权限或菜单本身变化后调用
+func (p ProfileImpl) InvalidateAll() {
+	ctx := context.Background()
+	keys, err := utils.Redis.Keys(ctx, "profile:*")
+	if err != nil {
+		log.Printf("failed to list profile caches: %v", err)
+	}
+	for _, key := range keys {
+		_ = utils.Redis.DelByKey(ctx, key)
+	}
+	p.evictAllLocal()
+	publishCacheEvict(cacheEvictMessage{AllUsers: true})
+}
+
+// evictLocal 清除指定用户的进程内缓存
+func (p ProfileImpl) evictLocal(userIds ...int64) {
+	localProfiles.Lock()
+	defer localProfiles.Unlock()
+	for _, userId := range userIds {
+		delete(localProfiles.entries, userId)
+	}
+}
+
+// evictAllLocal 清除全部进程内缓存
+func (p ProfileImpl) evictAllLocal() {
+	localProfiles.Lock()
+	defer localProfiles.Unlock()
+	localProfiles.entries = map[int64]localProfile{}
+}
+
+func profileKey(userId int64) string {
+	return fmt.Sprintf("profile:%d", userId)
+}
@@ -0,0 +1,155 @@
+package impl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/userStatus"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+	"tiny-admin-api-serve/utils/mailer"
+)
+
+const (
+	defaultVerifyTTL      = 24 * time.Hour // 未配置时邮箱验证令牌的有效期
+	verifyRequestInterval = 60             // 同一用户两次发送验证邮件的最小间隔（秒）
+)
+
+var errInvalidVerifyToken = errors.New("verification token is invalid or expired")
+
+type RegisterImpl struct {
+}
+
+var Register = RegisterImpl{}
+
+// config 读取register配置，未配置时视为关闭自助注册
+func (r RegisterImpl) config() setting.RegisterConfig {
+	if setting.Conf.RegisterConfig == nil {
+		return setting.RegisterConfig{}
+	}
+	return *setting.Conf.RegisterConfig
+}
+
+// Register 自助注册，创建未验证状态的用户并发送验证邮件
+func (r RegisterImpl) Register(body dto.RegisterBody) (*dto.User, error) {
+	config := r.config()
+	if !config.Enabled {
+		return nil, errors.New("self registration is disabled")
+	}
+	if !r.domainAllowed(body.Email, config.AllowedDomains) {
+		return nil, errors.New("email domain is not allowed")
+	}
+
+	// 默认角色不存在时拒绝注册，避免创建没有任何权限的账户后无法察觉配置错误
+	var roleIds []int64
+	if config.DefaultRole != "" {
+		var role dto.Role
+		if err := utils.Db.DB.Where("name = ?", config.DefaultRole).First(&role).Error; err != nil {
+			return nil, fmt.Errorf("default role %q not found", config.DefaultRole)
+		}
+		roleIds = append(roleIds, role.ID)
+	}
+
+	status := userStatus.Unverified
+	user, err := User.CreateUser(dto.CreateUserDto{
+		Name:     body.Name,
+		Email:    body.Email,
+		Password: body.Password,
+		RoleIds:  roleIds,
+		Status:   &status,
+	}, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.sendVerifyMail(user); err != nil {
+		log.Printf("send verification mail to %s failed: %v", user.Email, err)
+	}
+	return user, nil
+}
+
+// Verify 校验邮箱验证令牌并激活账户，令牌只能使用一次
+func (r RegisterImpl) Verify(token string) error {
+	value, err := utils.Redis.GetDel(context.Background(), verifyTokenKey(token))
+	if err != nil {
+		return errInvalidVerifyToken
+	}
+	userId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return errInvalidVerifyToken
+	}
+	return utils.Db.DB.Model(&dto.User{}).
+		Where("id = ? AND status = ?", userId, userStatus.Unverified).
+		Update("status", userStatus.Enable).Error
+}
+
+// Resend 重新发送验证邮件，邮箱不存在、已验证或请求过于频繁时静默返回
+func (r RegisterImpl) Resend(email string) error {
+	var user dto.User
+	if err := User.FindByEmail(email, &user); err != nil || user.Status != userStatus.Unverified {
+		return nil
+	}
+	return r.sendVerifyMail(&user)
+}
+
+// sendVerifyMail 生成邮箱验证令牌并发送验证邮件
+func (r RegisterImpl) sendVerifyMail(user *dto.User) error {
+	ctx := context.Background()
+	if !utils.Redis.SetStrNotExist(ctx, verifyThrottleKey(user.ID), "1", verifyRequestInterval) {
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	ttl := defaultVerifyTTL
+	config := r.config()
+	if config.VerifyTTL > 0 {
+		ttl = time.Duration(config.VerifyTTL) * time.Minute
+	}
+	if err := utils.Redis.SetStr(ctx, verifyTokenKey(token), strconv.FormatInt(user.ID, 10), ttl); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("您好 %s：\n\n感谢注册，请在%d分钟内打开以下链接验证您的邮箱，验证后即可登录：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件。\n",
+		user.Name, int(ttl.Minutes()), appendQuery(config.VerifyURL, "token", token))
+	return mailer.Send(user.Email, "验证邮箱", body)
+}
+
+// domainAllowed 邮箱域名是否在允许列表中，列表为空时不限制
+func (r RegisterImpl) domainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range domains {
+		if domain == strings.ToLower(strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("email_verify:%s", hex.EncodeToString(sum[:]))
+}
+
+func verifyThrottleKey(userId int64) string {
+	return fmt.Sprintf("email_verify_throttle:%d", userId)
+}
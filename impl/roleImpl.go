@@ -4,7 +4,10 @@ package impl
 import (
 	"errors"
 	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/dataScope"
 	"tiny-admin-api-serve/utils"
+
+	"gorm.io/gorm"
 )
 
 type RoleImpl struct {
@@ -13,8 +16,8 @@ type RoleImpl struct {
 
 var Role = RoleImpl{}
 
-// CreateRole 创建角色
-func (r RoleImpl) CreateRole(createRoleDto dto.CreateRoleDto, isInit bool) (*dto.Role, error) {
+// CreateRole 创建角色，operator只能授予自己拥有的权限和菜单
+func (r RoleImpl) CreateRole(createRoleDto dto.CreateRoleDto, isInit bool, operator *Operator) (*dto.Role, error) {
 	// 检查角色是否已存在
 	var existingRole dto.Role
 	err := utils.Db.DB.Where("name = ?", createRoleDto.Name).First(&existingRole).Error
@@ -27,14 +30,43 @@ func (r RoleImpl) CreateRole(createRoleDto dto.CreateRoleDto, isInit bool) (*dto
 		return nil, errors.New("role already exists")
 	}
 
-	// 创建新角色
-	newRole := dto.Role{
-		Name: createRoleDto.Name,
+	if err := r.checkParent(0, createRoleDto.ParentId); err != nil {
+		return nil, err
+	}
+	if createRoleDto.DataScope == "" {
+		createRoleDto.DataScope = dataScope.All
+	}
+	depts, err := r.findDataScopeDepts(createRoleDto.DataScope, createRoleDto.DeptIds)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := r.findPermissions(createRoleDto.PermissionIds)
+	if err != nil {
+		return nil, err
+	}
+	menus, err := r.findMenus(createRoleDto.MenuIds)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkGrants(operator, nil, permissions, menus, createRoleDto.ParentId); err != nil {
+		return nil, err
 	}
 
-	result := utils.Db.DB.Create(&newRole)
-	if result.Error != nil {
-		return nil, result.Error
+	// 创建新角色，并在同一事务中写入关联的权限、菜单和部门
+	newRole := dto.Role{
+		Name:             createRoleDto.Name,
+		ParentId:         createRoleDto.ParentId,
+		RequireTwoFactor: createRoleDto.RequireTwoFactor,
+		DataScope:        createRoleDto.DataScope,
+	}
+	err = utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newRole).Error; err != nil {
+			return err
+		}
+		return r.replaceAssociations(tx, &newRole, permissions, menus, depts)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &newRole, nil
@@ -70,6 +102,11 @@ func (r RoleImpl) FindAllDetail(page, limit int, name string) (*dto.RolePMVo, er
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	for i := range roles {
+		if err := r.fillEffective(&roles[i]); err != nil {
+			return nil, err
+		}
+	}
 	menuList, _ := Menu.FindAllMenu()
 	// 计算分页元数据
 	totalPages := int((total + int64(limit) - 1) / int64(limit)) // 向上取整计算总页数
@@ -90,22 +127,54 @@ func (r RoleImpl) FindAllDetail(page, limit int, name string) (*dto.RolePMVo, er
 	return rolePMVo, nil
 }
 
-// UpdateRole 更新角色
-func (r RoleImpl) UpdateRole(updateRoleDto dto.UpdateRoleDto) (*dto.Role, error) {
+// UpdateRole 更新角色，operator只能新增授予自己拥有的权限和菜单
+func (r RoleImpl) UpdateRole(updateRoleDto dto.UpdateRoleDto, operator *Operator) (*dto.Role, error) {
 	var role dto.Role
-	err := utils.Db.DB.Where("id = ?", updateRoleDto.ID).First(&role).Error
+	err := utils.Db.DB.Where("id = ?", updateRoleDto.ID).Preload("Permissions").Preload("Menus").First(&role).Error
 	if err != nil {
 		return nil, errors.New("role not found")
 	}
+	current := role
 
 	if updateRoleDto.Name != "" {
 		role.Name = updateRoleDto.Name
 	}
+	if err := r.checkParent(role.ID, updateRoleDto.ParentId); err != nil {
+		return nil, err
+	}
+	role.ParentId = updateRoleDto.ParentId
+	if updateRoleDto.RequireTwoFactor != nil {
+		role.RequireTwoFactor = *updateRoleDto.RequireTwoFactor
+	}
+	if updateRoleDto.DataScope != "" {
+		role.DataScope = updateRoleDto.DataScope
+	}
+	depts, err := r.findDataScopeDepts(role.DataScope, updateRoleDto.DeptIds)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := r.findPermissions(updateRoleDto.PermissionIds)
+	if err != nil {
+		return nil, err
+	}
+	menus, err := r.findMenus(updateRoleDto.MenuIds)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkGrants(operator, &current, permissions, menus, role.ParentId); err != nil {
+		return nil, err
+	}
 
-	result := utils.Db.DB.Save(&role)
-	if result.Error != nil {
-		return nil, result.Error
+	err = utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions", "Menus").Save(&role).Error; err != nil {
+			return err
+		}
+		return r.replaceAssociations(tx, &role, permissions, menus, depts)
+	})
+	if err != nil {
+		return nil, err
 	}
+	Profile.InvalidateRoles(role.ID)
 
 	return &role, nil
 }
@@ -120,17 +189,26 @@ func (r RoleImpl) RemoveRoleById(id int) (map[string]string, error) {
 
 	// 检查是否有用户关联该角色
 	var userCount int64
-	utils.Db.DB.Model(&dto.User{}).Joins("JOIN user_roles ON users.id = user_roles.user_id").
-		Where("user_roles.role_id = ?", id).Count(&userCount)
+	utils.Db.DB.Table("user_role").Where("role_id = ?", id).Count(&userCount)
 
 	if userCount > 0 {
 		return nil, errors.New("role is associated with users, cannot delete")
 	}
+	var childCount int64
+	utils.Db.DB.Model(&dto.Role{}).Where("parent_id = ?", id).Count(&childCount)
+	if childCount > 0 {
+		return nil, errors.New("role has child roles, cannot delete")
+	}
 
-	// 删除角色
-	result := utils.Db.DB.Delete(&role)
-	if result.Error != nil {
-		return nil, result.Error
+	// 删除角色及其关联的权限、菜单和部门
+	err = utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := r.replaceAssociations(tx, &role, []dto.Permission{}, []dto.Menu{}, []dto.Dept{}); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	resultMap := map[string]string{
@@ -169,3 +247,320 @@ func (r RoleImpl) FindOne(id int) (*dto.Role, error) {
 
 	return &role, nil
 }
+
+// findDataScopeDepts 校验数据范围，数据范围为custom时查询指定的部门，其他数据范围不关联部门
+func (r RoleImpl) findDataScopeDepts(scope string, deptIds []int64) ([]dto.Dept, error) {
+	if !dataScope.Valid(scope) {
+		return nil, errors.New("invalid data scope")
+	}
+	depts := []dto.Dept{}
+	if scope != dataScope.Custom {
+		return depts, nil
+	}
+	deptIds = uniqueIds(deptIds)
+	if len(deptIds) == 0 {
+		return nil, errors.New("custom data scope requires at least one dept")
+	}
+	if err := utils.Db.DB.Where("id IN ?", deptIds).Find(&depts).Error; err != nil {
+		return nil, err
+	}
+	if len(depts) != len(deptIds) {
+		return nil, errors.New("dept not found")
+	}
+	return depts, nil
+}
+
+// AddPermission 为角色添加单个权限，operator只能授予自己拥有的权限
+func (r RoleImpl) AddPermission(roleId, permissionId int64, operator *Operator) (*dto.Role, error) {
+	return r.changeAssociation(roleId, "Permissions", func(association *gorm.Association) error {
+		permissions, err := r.findPermissions([]int64{permissionId})
+		if err != nil {
+			return err
+		}
+		if err := r.checkGrants(operator, nil, permissions, nil, nil); err != nil {
+			return err
+		}
+		return association.Append(permissions)
+	})
+}
+
+// RemovePermission 移除角色的单个权限
+func (r RoleImpl) RemovePermission(roleId, permissionId int64) (*dto.Role, error) {
+	return r.changeAssociation(roleId, "Permissions", func(association *gorm.Association) error {
+		return association.Delete(&dto.Permission{ID: int(permissionId)})
+	})
+}
+
+// AddMenu 为角色添加单个菜单，operator只能授予自己可见的菜单
+func (r RoleImpl) AddMenu(roleId, menuId int64, operator *Operator) (*dto.Role, error) {
+	return r.changeAssociation(roleId, "Menus", func(association *gorm.Association) error {
+		menus, err := r.findMenus([]int64{menuId})
+		if err != nil {
+			return err
+		}
+		if err := r.checkGrants(operator, nil, nil, menus, nil); err != nil {
+			return err
+		}
+		return association.Append(menus)
+	})
+}
+
+// RemoveMenu 移除角色的单个菜单
+func (r RoleImpl) RemoveMenu(roleId, menuId int64) (*dto.Role, error) {
+	return r.changeAssociation(roleId, "Menus", func(association *gorm.Association) error {
+		return association.Delete(&dto.Menu{ID: menuId})
+	})
+}
+
+// changeAssociation 修改角色的权限或菜单关联，返回修改后的角色
+func (r RoleImpl) changeAssociation(roleId int64, name string, change func(association *gorm.Association) error) (*dto.Role, error) {
+	var role dto.Role
+	if err := utils.Db.DB.Where("id = ?", roleId).First(&role).Error; err != nil {
+		return nil, errors.New("role not found")
+	}
+	if err := change(utils.Db.DB.Model(&role).Association(name)); err != nil {
+		return nil, err
+	}
+	Profile.InvalidateRoles(role.ID)
+	return r.FindOne(int(role.ID))
+}
+
+// checkGrants 校验操作者能否为角色授予权限、菜单和上级角色，避免为自己拥有的角色授予自己没有的权限来提升权限
+// 新增的权限操作者必须拥有（含通配符），新增的菜单操作者必须可见，新设置的上级角色操作者必须拥有；
+// current为修改前的角色，已有的关联不再校验；operator为nil时表示系统内部调用，不做限制
+func (r RoleImpl) checkGrants(operator *Operator, current *dto.Role, permissions []dto.Permission, menus []dto.Menu, parentId *int64) error {
+	if operator == nil {
+		return nil
+	}
+	existing := dto.Role{}
+	if current != nil {
+		existing = *current
+	}
+	for _, permission := range permissions {
+		if containsPermission(existing.Permissions, permission.ID) {
+			continue
+		}
+		allowed, err := operator.HasPermission(permission.Name)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrPermissionDenied
+		}
+	}
+	for _, menu := range menus {
+		if containsMenu(existing.Menus, menu.ID) {
+			continue
+		}
+		visible, err := operator.HasMenu(menu.ID)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return ErrPermissionDenied
+		}
+	}
+	if parentId != nil && (existing.ParentId == nil || *existing.ParentId != *parentId) {
+		held, err := operator.HoldsRole(*parentId)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return ErrRoleNotHeld
+		}
+	}
+	return nil
+}
+
+func containsPermission(permissions []dto.Permission, id int) bool {
+	for _, permission := range permissions {
+		if permission.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMenu(menus []dto.Menu, id int64) bool {
+	for _, menu := range menus {
+		if menu.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceAssociations 替换角色关联的权限、菜单和部门
+func (r RoleImpl) replaceAssociations(tx *gorm.DB, role *dto.Role, permissions []dto.Permission, menus []dto.Menu, depts []dto.Dept) error {
+	if err := tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+		return err
+	}
+	if err := tx.Model(role).Association("Menus").Replace(menus); err != nil {
+		return err
+	}
+	return tx.Model(role).Association("Depts").Replace(depts)
+}
+
+// FindByIds 根据ID查询角色，任一ID不存在时返回错误
+func (r RoleImpl) FindByIds(ids []int64) ([]dto.Role, error) {
+	roles := []dto.Role{}
+	ids = uniqueIds(ids)
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := utils.Db.DB.Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	if len(roles) != len(ids) {
+		return nil, errors.New("role not found")
+	}
+	return roles, nil
+}
+
+// findPermissions 根据ID查询权限，任一ID不存在时返回错误
+func (r RoleImpl) findPermissions(ids []int64) ([]dto.Permission, error) {
+	permissions := []dto.Permission{}
+	ids = uniqueIds(ids)
+	if len(ids) == 0 {
+		return permissions, nil
+	}
+	if err := utils.Db.DB.Where("id IN ?", ids).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	if len(permissions) != len(ids) {
+		return nil, errors.New("permission not found")
+	}
+	return permissions, nil
+}
+
+// findMenus 根据ID查询菜单，任一ID不存在时返回错误
+func (r RoleImpl) findMenus(ids []int64) ([]dto.Menu, error) {
+	menus := []dto.Menu{}
+	ids = uniqueIds(ids)
+	if len(ids) == 0 {
+		return menus, nil
+	}
+	if err := utils.Db.DB.Where("id IN ?", ids).Find(&menus).Error; err != nil {
+		return nil, err
+	}
+	if len(menus) != len(ids) {
+		return nil, errors.New("menu not found")
+	}
+	return menus, nil
+}
+
+// uniqueIds 去除重复的ID
+func uniqueIds(ids []int64) []int64 {
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !utils.IsInArray(id, result) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// checkParent 校验上级角色存在，且设置后不会形成循环继承
+func (r RoleImpl) checkParent(roleId int64, parentId *int64) error {
+	if parentId == nil {
+		return nil
+	}
+	if *parentId == roleId {
+		return errors.New("role cannot inherit from itself")
+	}
+	parents, err := r.parents()
+	if err != nil {
+		return err
+	}
+	if _, ok := parents[*parentId]; !ok {
+		return errors.New("parent role not found")
+	}
+	// 沿上级角色链向上查找，遇到当前角色说明会形成循环
+	visited := map[int64]bool{}
+	for id := parentId; id != nil && !visited[*id]; id = parents[*id] {
+		if *id == roleId {
+			return errors.New("role inheritance cycle detected")
+		}
+		visited[*id] = true
+	}
+	return nil
+}
+
+// WithAncestors 返回指定角色及其上级角色链上全部角色的ID
+func (r RoleImpl) WithAncestors(ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return []int64{}, nil
+	}
+	parents, err := r.parents()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int64, 0, len(ids))
+	for _, roleId := range ids {
+		// 已访问的角色不再向上查找，同时避免数据中存在循环时死循环
+		for id := &roleId; id != nil && !utils.IsInArray(*id, result); id = parents[*id] {
+			result = append(result, *id)
+		}
+	}
+	return result, nil
+}
+
+// WithDescendants 返回指定角色及继承自它们的全部下级角色的ID
+func (r RoleImpl) WithDescendants(ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return []int64{}, nil
+	}
+	parents, err := r.parents()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int64][]int64)
+	for id, parentId := range parents {
+		if parentId != nil {
+			children[*parentId] = append(children[*parentId], id)
+		}
+	}
+	result := make([]int64, 0, len(ids))
+	queue := append([]int64{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if utils.IsInArray(id, result) {
+			continue
+		}
+		result = append(result, id)
+		queue = append(queue, children[id]...)
+	}
+	return result, nil
+}
+
+// parents 查询全部角色的上级角色
+func (r RoleImpl) parents() (map[int64]*int64, error) {
+	var roles []dto.Role
+	if err := utils.Db.DB.Select("id", "parent_id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	parents := make(map[int64]*int64, len(roles))
+	for _, role := range roles {
+		parents[role.ID] = role.ParentId
+	}
+	return parents, nil
+}
+
+// fillEffective 填充角色包含继承在内的全部权限和菜单
+func (r RoleImpl) fillEffective(role *dto.Role) error {
+	roleIds, err := r.WithAncestors([]int64{role.ID})
+	if err != nil {
+		return err
+	}
+	role.EffectivePermissions = []dto.Permission{}
+	err = utils.Db.DB.Distinct().
+		Joins("JOIN role_permission ON permission.id = role_permission.permission_id").
+		Where("role_permission.role_id IN ?", roleIds).
+		Find(&role.EffectivePermissions).Error
+	if err != nil {
+		return err
+	}
+	role.EffectiveMenus, err = Menu.FindMenusByRoleIds([]int64{role.ID})
+	return err
+}
@@ -0,0 +1,73 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	tokenVersionCacheTTL = 24 * time.Hour // Redis中缓存的token版本有效期，过期后从MySQL重新加载
+	tokenVersionRevoked  = "revoked"      // 用户已删除，缓存中写入该值，并发读取也不会再写入旧版本
+)
+
+// TokenVersionImpl 用户token版本，写入签发的token中，版本递增后该用户此前签发的token全部失效
+type TokenVersionImpl struct {
+}
+
+var TokenVersion = TokenVersionImpl{}
+
+// Current 获取用户当前的token版本，优先读取Redis缓存，用户不存在时返回错误
+func (t TokenVersionImpl) Current(userId int64) (int64, error) {
+	ctx := context.Background()
+	if value, err := utils.Redis.GetStr(ctx, tokenVersionKey(userId)); err == nil {
+		if value == tokenVersionRevoked {
+			return 0, errors.New("user not found")
+		}
+		if version, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return version, nil
+		}
+	}
+
+	var user dto.User
+	if err := utils.Db.DB.Select("id", "token_version").Where("id = ?", userId).First(&user).Error; err != nil {
+		return 0, err
+	}
+	// 只在缓存不存在时写入，避免并发读取到的旧版本覆盖Bump写入的新版本
+	utils.Redis.SetStrNotExist(ctx, tokenVersionKey(userId), strconv.FormatInt(user.TokenVersion, 10), int(tokenVersionCacheTTL.Seconds()))
+	return user.TokenVersion, nil
+}
+
+// Bump 递增用户的token版本，使该用户此前签发的全部token失效
+// 修改密码、调整角色、停用账户或管理员强制下线时调用
+func (t TokenVersionImpl) Bump(userId int64) error {
+	err := utils.Db.DB.Model(&dto.User{}).Where("id = ?", userId).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	var user dto.User
+	if err := utils.Db.DB.Select("id", "token_version").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	return utils.Redis.SetStr(context.Background(), tokenVersionKey(userId), strconv.FormatInt(user.TokenVersion, 10), tokenVersionCacheTTL)
+}
+
+// Revoke 删除用户前调用，使该用户已签发的全部token立即失效，用户删除后也不会再从缓存读取到有效版本
+func (t TokenVersionImpl) Revoke(userId int64) error {
+	if err := t.Bump(userId); err != nil {
+		return err
+	}
+	return utils.Redis.SetStr(context.Background(), tokenVersionKey(userId), tokenVersionRevoked, tokenVersionCacheTTL)
+}
+
+func tokenVersionKey(userId int64) string {
+	return fmt.Sprintf("token_version:%d", userId)
+}
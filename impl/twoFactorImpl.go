@@ -0,0 +1,220 @@
+package impl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+const (
+	totpSetupTTL      = 10 * time.Minute // 绑定流程中未确认密钥的有效期
+	loginChallengeTTL = 5 * time.Minute  // 登录挑战令牌有效期
+	recoveryCodeCount = 10               // 每次生成的恢复码数量
+)
+
+type TwoFactorImpl struct {
+}
+
+var TwoFactor = TwoFactorImpl{}
+
+// Setup 生成新的TOTP密钥，确认之前不会生效
+// 已启用双因素认证时需要校验当前的验证码或恢复码，避免token泄露后被替换密钥和恢复码
+func (t TwoFactorImpl) Setup(userId int64, email, currentCode string) (*dto.TotpSetupVo, error) {
+	var user dto.User
+	if err := utils.Db.DB.Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.TotpEnabled && !t.Verify(&user, currentCode) {
+		return nil, errors.New("two-factor authentication is already enabled, current verification code is required")
+	}
+
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.Redis.SetStr(context.Background(), totpSetupKey(userId), secret, totpSetupTTL); err != nil {
+		return nil, err
+	}
+
+	issuer := setting.Conf.Name
+	if issuer == "" {
+		issuer = "tiny-admin"
+	}
+	uri := utils.TotpProvisioningURI(issuer, email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TotpSetupVo{
+		Secret: secret,
+		Uri:    uri,
+		QrCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Confirm 使用验证码确认绑定，启用双因素认证并返回一次性恢复码
+func (t TwoFactorImpl) Confirm(userId int64, code string) ([]string, error) {
+	ctx := context.Background()
+	secret, err := utils.Redis.GetStr(ctx, totpSetupKey(userId))
+	if err != nil {
+		return nil, errors.New("two-factor setup expired, please start again")
+	}
+	if !utils.VerifyTotp(secret, code, time.Now()) {
+		return nil, errors.New("invalid verification code")
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	err = utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&dto.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true})
+		if result.Error != nil {
+			return result.Error
+		}
+		generated, err := t.replaceRecoveryCodes(tx, userId)
+		if err != nil {
+			return err
+		}
+		codes = generated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_ = utils.Redis.DelByKey(ctx, totpSetupKey(userId))
+	return codes, nil
+}
+
+// Disable 校验验证码后关闭双因素认证，角色要求双因素认证时不允许关闭
+func (t TwoFactorImpl) Disable(userId int64, code string) error {
+	var user dto.User
+	if err := utils.Db.DB.Where("id = ?", userId).First(&user).Error; err != nil {
+		return errors.New("user not found")
+	}
+	if !user.TotpEnabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+	if t.RequiredForUser(userId) {
+		return errors.New("two-factor authentication is required by your role")
+	}
+	if !t.Verify(&user, code) {
+		return errors.New("invalid verification code")
+	}
+
+	return utils.Db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&dto.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false})
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Where("user_id = ?", userId).Delete(&dto.UserRecoveryCode{}).Error
+	})
+}
+
+// Verify 校验TOTP验证码或恢复码，验证码在有效期内不可重复使用，恢复码使用后作废
+func (t TwoFactorImpl) Verify(user *dto.User, code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if !user.TotpEnabled || code == "" {
+		return false
+	}
+
+	if utils.VerifyTotp(user.TotpSecret, code, time.Now()) {
+		// 同一验证码在允许的时间窗口内只能使用一次，防止重放
+		return utils.Redis.SetStrNotExist(context.Background(), fmt.Sprintf("totp_used:%d:%s", user.ID, code), "1", 90)
+	}
+
+	result := utils.Db.DB.Model(&dto.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used = ?", user.ID, hashRecoveryCode(code), false).
+		Update("used", true)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// RequiredForUser 用户的任一角色要求双因素认证时返回true
+func (t TwoFactorImpl) RequiredForUser(userId int64) bool {
+	var count int64
+	utils.Db.DB.Model(&dto.Role{}).
+		Joins("JOIN user_role ON user_role.role_id = role.id").
+		Where("user_role.user_id = ? AND role.require_two_factor = ?", userId, true).
+		Count(&count)
+	return count > 0
+}
+
+// CreateLoginChallenge 密码校验通过后生成短期挑战令牌，用于第二步验证
+func (t TwoFactorImpl) CreateLoginChallenge(userId int64) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(buf)
+	err := utils.Redis.SetStr(context.Background(), loginChallengeKey(challenge), strconv.FormatInt(userId, 10), loginChallengeTTL)
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// PeekLoginChallenge 获取挑战令牌对应的用户ID，不会使令牌失效
+func (t TwoFactorImpl) PeekLoginChallenge(challenge string) (int64, error) {
+	value, err := utils.Redis.GetStr(context.Background(), loginChallengeKey(challenge))
+	if err != nil {
+		return 0, errors.New("login challenge expired, please login again")
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// ConsumeLoginChallenge 使挑战令牌失效，返回false表示令牌已被使用或已过期
+func (t TwoFactorImpl) ConsumeLoginChallenge(challenge string) bool {
+	_, err := utils.Redis.GetDel(context.Background(), loginChallengeKey(challenge))
+	return err == nil
+}
+
+// replaceRecoveryCodes 生成新的恢复码并替换旧的恢复码
+func (t TwoFactorImpl) replaceRecoveryCodes(tx *gorm.DB, userId int64) ([]string, error) {
+	if err := tx.Where("user_id = ?", userId).Delete(&dto.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]dto.UserRecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(buf)
+		codes = append(codes, code)
+		records = append(records, dto.UserRecoveryCode{UserID: userId, CodeHash: hashRecoveryCode(code)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func totpSetupKey(userId int64) string {
+	return fmt.Sprintf("totp_setup:%d", userId)
+}
+
+func loginChallengeKey(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return fmt.Sprintf("login_challenge:%s", hex.EncodeToString(sum[:]))
+}
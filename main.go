@@ -1,34 +1,52 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"tiny-admin-api-serve/impl"
 	"tiny-admin-api-serve/middleware"
 	jsonmiddleware "tiny-admin-api-serve/middleware/json"
 	routers "tiny-admin-api-serve/routes"
+	"tiny-admin-api-serve/setting"
+	"tiny-admin-api-serve/utils"
+	"tiny-admin-api-serve/utils/mailer"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 )
 
 func main() {
-	viper.SetConfigFile("./config/config.yaml")
-
-	err := viper.ReadInConfig() // 读取配置信息
-	if err != nil {
-		// 读取配置信息失败
-		fmt.Printf("viper.ReadInConfig failed, err:%v\n", err)
+	// 读取配置，再按配置连接数据库、redis并初始化鉴权中间件
+	setting.Init()
+	utils.InitDb()
+	utils.InitRedis()
+	middleware.Init()
+	// 邮件配置错误时启动失败，避免到发送时才发现
+	if _, err := mailer.Default(); err != nil {
+		panic(err)
+	}
+	// 同步新增的表和列
+	if err := impl.AutoMigrate(); err != nil {
 		panic(err)
-		return
 	}
+	// 集群部署时订阅其他节点发出的缓存失效消息
+	impl.ListenCacheEvict()
 	r := gin.Default()
+	// 客户端IP用于登录锁定和访问策略，只信任配置的反向代理转发的X-Forwarded-For，避免伪造
+	if err := r.SetTrustedProxies(setting.Conf.TrustedProxies); err != nil {
+		panic(err)
+	}
+	r.TrustedPlatform = setting.Conf.TrustedPlatform
 	// 应用自定义JSON序列化中间件
 	r.Use(jsonmiddleware.CustomJSON())
-	// 应用全局鉴权中间件，默认所有路由都需要鉴权，只有标记了IsPublic的路由才开放
+	// 应用全局鉴权中间件，默认所有路由都需要鉴权，只有注册时标记为Public的路由才开放
 	r.Use(middleware.Auth.AuthRequired())
 	// 注册路由
 	routers.RouterUser(r)
-	err = r.Run(":" + viper.GetString("port"))
+	// 按路由所需的权限同步权限表
+	if err := routers.SyncPermissions(); err != nil {
+		log.Printf("failed to sync permissions: %v", err)
+	}
+	err := r.Run(":" + viper.GetString("port"))
 	if err != nil {
 		log.Printf("failed to start server: %v", err)
 	}
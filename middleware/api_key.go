@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticateApiKey 校验API密钥并构造与JWT相同结构的用户声明
+func (m *AuthMiddleware) authenticateApiKey(key, clientIP string) (*UserClaims, error) {
+	apiKey, user, err := impl.ApiKey.Authenticate(key, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	return &UserClaims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     "user",
+		ApiKeyID: apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+// IsApiKeyRequest 当前请求是否通过API密钥认证
+func IsApiKeyRequest(c *gin.Context) bool {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return false
+	}
+	userClaims, ok := claims.(*UserClaims)
+	return ok && userClaims.ApiKeyID != 0
+}
+
+// DenyApiKey 拒绝通过API密钥访问，用于管理密钥、会话、密码和双因素认证等账户安全相关的路由
+func DenyApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsApiKeyRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to api keys"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,11 +2,15 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/setting"
 	"tiny-admin-api-serve/utils"
 
 	"github.com/gin-gonic/gin"
@@ -16,47 +20,60 @@ import (
 
 // AuthMiddleware 鉴权中间件结构体
 type AuthMiddleware struct {
-	secretKey []byte
-	issuer    string
+	secretKey  []byte
+	issuer     string
+	accessTTL  time.Duration // 访问令牌有效期
+	refreshTTL time.Duration // 刷新令牌有效期
+	keys       *keySet       // 非对称签名密钥，配置了jwt.signing_kid时用于签名
 }
 
 var Auth AuthMiddleware
 
 // UserClaims 用户自定义声明结构体
 type UserClaims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID              int64    `json:"user_id"`
+	Email               string   `json:"email"`
+	Role                string   `json:"role"`
+	SessionID           string   `json:"sid,omitempty"`       // 所属登录会话，即登录时签发token的jti
+	Pending             string   `json:"pending,omitempty"`   // 待完成的操作，不为空时token只能访问完成该操作所需的路由
+	TokenVersion        int64    `json:"ver"`                 // 签发时用户的token版本，与当前版本不一致时token失效
+	ImpersonatorID      int64    `json:"imp_id,omitempty"`    // 模拟登录时操作者的用户ID，此时UserID为被模拟的用户
+	ImpersonatorEmail   string   `json:"imp_email,omitempty"` // 模拟登录时操作者的邮箱
+	ImpersonatorVersion int64    `json:"imp_ver,omitempty"`   // 模拟登录时操作者的token版本，与当前版本不一致时token失效
+	ApiKeyID            int64    `json:"-"`                   // 通过API密钥认证时的密钥ID，不写入JWT
+	Scopes              []string `json:"-"`                   // API密钥可使用的权限
 	jwt.RegisteredClaims
 }
 
-// 初始化全局AuthMiddleware
-func init() {
+// Init 按jwt和token配置初始化全局AuthMiddleware，需在setting.Init读取配置后调用
+func Init() {
 	Auth = AuthMiddleware{
-		secretKey: []byte(viper.GetString("jwt.secret")),
-		issuer:    viper.GetString("jwt.app_name"),
+		secretKey:  []byte(viper.GetString("jwt.secret")),
+		issuer:     viper.GetString("jwt.app_name"),
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 7 * 24 * time.Hour,
 	}
-}
-
-// IsPublic 标记路由为公开访问（类似Java的@Public注解）
-func IsPublic() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 在请求上下文中设置公开标记
-		c.Set("isPublic", true)
-		// 继续执行后续中间件
-		c.Next()
+	keys, err := loadKeySet()
+	if err != nil {
+		panic(err)
+	}
+	Auth.keys = keys
+	// 令牌有效期从token配置读取，未配置时使用默认值
+	if setting.Conf.TokenConfig != nil {
+		if setting.Conf.TokenConfig.ExpireTime > 0 {
+			Auth.accessTTL = time.Duration(setting.Conf.TokenConfig.ExpireTime) * time.Minute
+		}
+		if setting.Conf.TokenConfig.RefreshExpireTime > 0 {
+			Auth.refreshTTL = time.Duration(setting.Conf.TokenConfig.RefreshExpireTime) * time.Minute
+		}
 	}
 }
 
-// AuthRequired 鉴权拦截器 - 支持类似Java注解的IsPublic标记
+// AuthRequired 鉴权拦截器，路由是否公开以注册路由时记录的元数据为准
 func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 步骤1: 检查当前路由是否有IsPublic中间件
-		handlerNames := c.HandlerNames()
-		handlersStr := fmt.Sprintf("%v", handlerNames)
-		hasIsPublic := strings.Contains(handlersStr, "IsPublic")
-		// 如果有IsPublic中间件，直接放行
-		if hasIsPublic {
+		// 步骤1: 检查当前路由是否标记为公开，未注册的路由一律需要鉴权
+		if Routes.IsPublic(c.Request.Method, c.FullPath()) {
 			c.Next()
 			return
 		}
@@ -68,6 +85,19 @@ func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		// API密钥认证，供CI、脚本等机器客户端使用
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			claims, err := m.authenticateApiKey(strings.TrimPrefix(authHeader, "ApiKey "), c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid api key: " + err.Error()})
+				c.Abort()
+				return
+			}
+			setUserContext(c, claims)
+			c.Next()
+			return
+		}
+
 		// 验证Bearer格式
 		if !strings.HasPrefix(authHeader, "Bearer ") {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token format required"})
@@ -84,35 +114,59 @@ func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		// 检查token是否在黑名单中(已注销)
+		// 检查token是否已注销（按jti加入黑名单），以及签发后用户的token版本是否已递增
 		ctx := context.Background()
-		exists := utils.Redis.Exists(ctx, fmt.Sprintf("blacklist:%s", tokenString))
-		if exists {
+		if utils.Redis.Exists(ctx, blacklistKey(claims.ID)) || !m.tokenVersionValid(claims) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
 			c.Abort()
 			return
 		}
 
+		// 检查token所属会话是否已被吊销
+		if claims.SessionID != "" && !m.sessionActive(ctx, claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// 模拟登录的操作者被停用、登出全部会话或失去模拟登录权限后，模拟登录token随即失效
+		if claims.ImpersonatorID != 0 && !m.impersonatorValid(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// 受限token只能访问完成待办操作所需的路由
+		if claims.Pending != "" && !pendingAllowed(claims.Pending, c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Pending action required", "pending": claims.Pending})
+			c.Abort()
+			return
+		}
+
 		// 步骤3: 将用户信息存储到上下文中
-		c.Set("user_id", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
-		c.Set("claims", claims)
+		setUserContext(c, claims)
+		// 模拟登录期间的每个请求都记录审计日志
+		if claims.ImpersonatorID != 0 {
+			RecordImpersonation(c, claims, impl.ImpersonationRequest, c.Request.Method+" "+c.FullPath())
+		}
 
 		// 步骤4: 继续执行后续中间件和路由处理函数
 		c.Next()
 	}
 }
 
+// setUserContext 将认证后的用户信息存储到上下文中
+func setUserContext(c *gin.Context, claims *UserClaims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("role", claims.Role)
+	c.Set("session_id", claims.SessionID)
+	c.Set("claims", claims)
+}
+
 // parseToken 解析并验证JWT token
 func (m *AuthMiddleware) parseToken(tokenString string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名方法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return m.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, m.keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -131,76 +185,115 @@ func (m *AuthMiddleware) parseToken(tokenString string) (*UserClaims, error) {
 	return claims, nil
 }
 
-// GenerateToken 生成JWT token
-func (m *AuthMiddleware) GenerateToken(userID int64, email, role string) (string, error) {
+// keyFunc 根据token头部选择验证密钥
+// 带kid的token使用对应的非对称公钥验证，旧密钥在过期前仍可验证；不带kid的token使用HMAC密钥验证
+func (m *AuthMiddleware) keyFunc(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key, err := m.keys.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.publicKey, nil
+	}
+
+	// 验证签名方法
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	if len(m.secretKey) == 0 {
+		return nil, errors.New("hmac tokens are not accepted")
+	}
+	return m.secretKey, nil
+}
+
+// JWKS 返回可用于验证token的公钥集合
+func (m *AuthMiddleware) JWKS() map[string]interface{} {
+	return m.keys.JWKS()
+}
+
+// GenerateToken 生成JWT token，sessionID为token所属的登录会话
+func (m *AuthMiddleware) GenerateToken(userID int64, email, role, sessionID string) (string, error) {
+	version, err := impl.TokenVersion.Current(userID)
+	if err != nil {
+		return "", err
+	}
+	record := refreshTokenRecord{UserID: userID, Email: email, Role: role, SessionID: sessionID, TokenVersion: version}
+	return m.generateToken(record, generateUniqueID())
+}
+
+// generateToken 使用指定jti生成JWT token
+func (m *AuthMiddleware) generateToken(record refreshTokenRecord, jti string) (string, error) {
 	claims := &UserClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:              record.UserID,
+		Email:               record.Email,
+		Role:                record.Role,
+		SessionID:           record.SessionID,
+		Pending:             record.Pending,
+		TokenVersion:        record.TokenVersion,
+		ImpersonatorID:      record.ImpersonatorID,
+		ImpersonatorEmail:   record.ImpersonatorEmail,
+		ImpersonatorVersion: record.ImpersonatorVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    m.issuer,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24小时过期
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.accessTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ID:        generateUniqueID(), // 可以使用UUID库生成唯一ID
+			ID:        jti,
 		},
 	}
 
+	// 配置了非对称签名密钥时使用RS256/EdDSA签名并写入kid，否则使用HMAC
+	if key := m.keys.signing; key != nil {
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.kid
+		return token.SignedString(key.privateKey)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(m.secretKey)
 }
 
-// Logout 用户登出，将token加入黑名单
+// Logout 用户登出，将token的jti加入黑名单，有效期与token剩余有效期相同
 func (m *AuthMiddleware) Logout(tokenString string) error {
-	ctx := context.Background()
-
-	// 解析token获取过期时间
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return m.secretKey, nil
-	})
-
+	claims, err := m.parseToken(tokenString)
 	if err != nil {
 		return err
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return errors.New("invalid token claims")
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("missing token id or expiration time")
 	}
 
-	exp, ok := claims["exp"].(float64)
-	if !ok {
-		return errors.New("missing expiration time")
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
 	}
-
-	// 计算剩余过期时间
-	ttl := time.Until(time.Unix(int64(exp), 0))
-
-	// 将token加入Redis黑名单，设置与token相同的过期时间
-	return utils.Redis.SetExpire(ctx, fmt.Sprintf("blacklist:%s", tokenString), ttl)
+	return utils.Redis.SetStr(context.Background(), blacklistKey(claims.ID), "1", ttl)
 }
 
-// RefreshToken 刷新token
-func (m *AuthMiddleware) RefreshToken(oldTokenString string) (string, error) {
-	claims, err := m.parseToken(oldTokenString)
-	if err != nil {
-		return "", err
+// LogoutEverywhere 递增用户的token版本并吊销全部会话，使该用户已签发的访问令牌和刷新令牌全部失效
+func (m *AuthMiddleware) LogoutEverywhere(userID int64) (int, error) {
+	if err := impl.TokenVersion.Bump(userID); err != nil {
+		return 0, err
 	}
+	return m.RevokeAllSessions(userID, "")
+}
 
-	// 生成新token
-	newToken, err := m.GenerateToken(claims.UserID, claims.Email, claims.Role)
-	if err != nil {
-		return "", err
-	}
+// tokenVersionValid token中的版本是否与用户当前的token版本一致，用户不存在时视为无效
+func (m *AuthMiddleware) tokenVersionValid(claims *UserClaims) bool {
+	version, err := impl.TokenVersion.Current(claims.UserID)
+	return err == nil && version == claims.TokenVersion
+}
 
-	// 将旧token加入黑名单
-	err = m.Logout(oldTokenString)
-	if err != nil {
-		return "", err
-	}
-	return newToken, nil
+func blacklistKey(jti string) string {
+	return fmt.Sprintf("token_blacklist:%s", jti)
 }
 
-// generateUniqueID 生成唯一ID（简化版，实际可使用UUID）
+// generateUniqueID 生成随机ID，用作jti和会话ID
 func generateUniqueID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
 }
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"tiny-admin-api-serve/enums/sessionStatus"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentDataScope 获取当前用户的数据范围，同一请求内只计算一次
+func CurrentDataScope(c *gin.Context) (*impl.UserDataScope, error) {
+	if scope, ok := c.Get(sessionStatus.DataScopeAspect); ok {
+		return scope.(*impl.UserDataScope), nil
+	}
+	scope, err := impl.DataScope.ForUser(c.MustGet("user_id").(int64))
+	if err != nil {
+		return nil, err
+	}
+	c.Set(sessionStatus.DataScopeAspect, scope)
+	return scope, nil
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonatePermission 发起模拟登录所需的权限，模拟登录期间操作者需一直拥有该权限
+const impersonatePermission = "user::impersonate"
+
+// GenerateImpersonationToken 签发模拟登录的访问令牌
+// 令牌以目标用户身份访问，同时记录操作者身份；不创建会话、不签发刷新令牌，过期后需要重新发起模拟登录
+func (m *AuthMiddleware) GenerateImpersonationToken(impersonator *UserClaims, target *dto.User) (string, string, error) {
+	version, err := impl.TokenVersion.Current(target.ID)
+	if err != nil {
+		return "", "", err
+	}
+	impersonatorVersion, err := impl.TokenVersion.Current(impersonator.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	record := refreshTokenRecord{
+		UserID:              target.ID,
+		Email:               target.Email,
+		Role:                "user",
+		TokenVersion:        version,
+		ImpersonatorID:      impersonator.UserID,
+		ImpersonatorEmail:   impersonator.Email,
+		ImpersonatorVersion: impersonatorVersion,
+	}
+	jti := generateUniqueID()
+	token, err := m.generateToken(record, jti)
+	if err != nil {
+		return "", "", err
+	}
+	return token, jti, nil
+}
+
+// impersonatorValid 模拟登录的操作者是否仍然有效：操作者的token版本未递增（未被停用、删除或登出全部会话），
+// 并且仍拥有模拟登录权限
+func (m *AuthMiddleware) impersonatorValid(claims *UserClaims) bool {
+	version, err := impl.TokenVersion.Current(claims.ImpersonatorID)
+	if err != nil || version != claims.ImpersonatorVersion {
+		return false
+	}
+	owned, err := impl.Profile.Permissions(claims.ImpersonatorID)
+	return err == nil && utils.HasPermission(owned, impersonatePermission)
+}
+
+// AccessTTLSeconds 访问令牌的有效期（秒）
+func (m *AuthMiddleware) AccessTTLSeconds() int64 {
+	return int64(m.accessTTL.Seconds())
+}
+
+// CurrentClaims 获取当前请求的用户声明
+func CurrentClaims(c *gin.Context) (*UserClaims, bool) {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return nil, false
+	}
+	userClaims, ok := claims.(*UserClaims)
+	return userClaims, ok
+}
+
+// IsImpersonating 当前请求是否使用模拟登录的token
+func IsImpersonating(c *gin.Context) bool {
+	claims, ok := CurrentClaims(c)
+	return ok && claims.ImpersonatorID != 0
+}
+
+// DenyImpersonation 拒绝模拟登录期间访问，用于修改密码、管理会话和密钥等敏感操作
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsImpersonating(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available while impersonating"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RecordImpersonation 使用模拟登录token的声明记录审计日志，日志异步写入
+func RecordImpersonation(c *gin.Context, claims *UserClaims, action, detail string) {
+	impl.Impersonation.RecordAsync(dto.ImpersonationLog{
+		ImpersonatorID:    claims.ImpersonatorID,
+		ImpersonatorEmail: claims.ImpersonatorEmail,
+		TargetID:          claims.UserID,
+		TargetEmail:       claims.Email,
+		Action:            action,
+		Detail:            detail,
+		TokenId:           claims.ID,
+		IpAddr:            c.ClientIP(),
+	})
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+// jwtKeyConfig jwt.keys 中单个密钥的配置
+type jwtKeyConfig struct {
+	Kid        string `mapstructure:"kid"`
+	PrivateKey string `mapstructure:"private_key"` // 私钥PEM文件路径，仅用于验证的旧密钥可不填
+	PublicKey  string `mapstructure:"public_key"`  // 公钥PEM文件路径，填写私钥时可省略
+	ExpiresAt  string `mapstructure:"expires_at"`  // 密钥停止验证的时间（RFC3339），为空表示不过期
+}
+
+// signingKey 已加载的非对称签名密钥
+type signingKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+	expiresAt  time.Time
+}
+
+// expired 密钥是否已过期
+func (k *signingKey) expired() bool {
+	return !k.expiresAt.IsZero() && time.Now().After(k.expiresAt)
+}
+
+// keySet 按kid索引的密钥集合，signing为当前签名密钥
+type keySet struct {
+	keys    map[string]*signingKey
+	order   []string
+	signing *signingKey
+}
+
+// loadKeySet 从配置加载全部密钥，未配置jwt.keys时返回空集合（仅使用HMAC）
+func loadKeySet() (*keySet, error) {
+	var configs []jwtKeyConfig
+	if err := viper.UnmarshalKey("jwt.keys", &configs); err != nil {
+		return nil, err
+	}
+
+	set := &keySet{keys: make(map[string]*signingKey)}
+	for _, cfg := range configs {
+		key, err := loadSigningKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key %q: %w", cfg.Kid, err)
+		}
+		if _, exists := set.keys[key.kid]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.kid)
+		}
+		set.keys[key.kid] = key
+		set.order = append(set.order, key.kid)
+	}
+
+	signingKid := viper.GetString("jwt.signing_kid")
+	if signingKid == "" {
+		return set, nil
+	}
+	key, ok := set.keys[signingKid]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in jwt.keys", signingKid)
+	}
+	if key.privateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKid)
+	}
+	set.signing = key
+	return set, nil
+}
+
+// loadSigningKey 读取PEM文件并根据密钥类型确定签名算法（RSA->RS256，Ed25519->EdDSA）
+func loadSigningKey(cfg jwtKeyConfig) (*signingKey, error) {
+	if cfg.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &signingKey{kid: cfg.Kid}
+
+	if cfg.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, cfg.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		key.expiresAt = expiresAt
+	}
+
+	switch {
+	case cfg.PrivateKey != "":
+		block, err := readPEM(cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.privateKey = privateKey
+		key.publicKey = privateKey.Public()
+	case cfg.PublicKey != "":
+		block, err := readPEM(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.publicKey = publicKey
+	default:
+		return nil, errors.New("private_key or public_key is required")
+	}
+
+	switch key.publicKey.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.publicKey)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// verificationKey 根据kid获取验证密钥，过期的密钥不再接受
+func (s *keySet) verificationKey(kid string) (*signingKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.expired() {
+		return nil, fmt.Errorf("key %q has expired", kid)
+	}
+	return key, nil
+}
+
+// JWKS 返回所有未过期公钥的JWK Set
+func (s *keySet) JWKS() map[string]interface{} {
+	keys := make([]map[string]string, 0, len(s.order))
+	for _, kid := range s.order {
+		key := s.keys[kid]
+		if key.expired() {
+			continue
+		}
+		jwk := map[string]string{
+			"kid": key.kid,
+			"alg": key.method.Alg(),
+			"use": "sig",
+		}
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+const (
+	// PendingTwoFactorSetup 角色要求双因素认证但用户尚未绑定
+	PendingTwoFactorSetup = "2fa_setup"
+	// PendingPasswordChange 密码超过最长使用天数，必须先修改密码
+	PendingPasswordChange = "password_change"
+)
+
+// pendingAllowedRoutes 受限token允许访问的路由
+var pendingAllowedRoutes = map[string][]string{
+	PendingTwoFactorSetup: {"/auth/2fa/setup", "/auth/2fa/confirm", "/auth/profile", "/auth/logout"},
+	PendingPasswordChange: {"/user/updatePwd", "/auth/profile", "/auth/logout"},
+}
+
+// pendingAllowed 判断受限token是否可以访问指定路由
+func pendingAllowed(pending, fullPath string) bool {
+	for _, path := range pendingAllowedRoutes[pending] {
+		if path == fullPath {
+			return true
+		}
+	}
+	return false
+}
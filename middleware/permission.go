@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 权限校验中间件，当前用户需拥有全部指定权限才放行
+// 用户权限通过 user_role -> role_permission 关联解析并缓存（见impl.Profile），支持"user::*"、"*"等通配符，需配合AuthRequired使用
+// API密钥只能使用用户当前权限与密钥scopes都覆盖的权限
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("user_id")
+		if !ok {
+			utils.PermissionDenied(c)
+			c.Abort()
+			return
+		}
+
+		owned, err := impl.Profile.Permissions(userID.(int64))
+		if err != nil {
+			utils.PermissionDenied(c)
+			c.Abort()
+			return
+		}
+
+		// 通过API密钥访问时，权限还必须在密钥的scopes内
+		var scopes []string
+		apiKey := false
+		if userClaims, ok := CurrentClaims(c); ok && userClaims.ApiKeyID != 0 {
+			scopes = userClaims.Scopes
+			apiKey = true
+		}
+
+		for _, permission := range permissions {
+			if !utils.HasPermission(owned, permission) || (apiKey && !utils.HasPermission(scopes, permission)) {
+				utils.PermissionDenied(c)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
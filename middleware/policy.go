@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"tiny-admin-api-serve/enums/sessionStatus"
+	"tiny-admin-api-serve/impl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentOperator 获取当前请求的操作者（用户、IP和数据范围），同一请求内只创建一次
+func CurrentOperator(c *gin.Context) (*impl.Operator, error) {
+	if operator, ok := c.Get(sessionStatus.OperatorAspect); ok {
+		return operator.(*impl.Operator), nil
+	}
+	scope, err := CurrentDataScope(c)
+	if err != nil {
+		return nil, err
+	}
+	operator := &impl.Operator{UserId: c.MustGet("user_id").(int64), Ip: c.ClientIP(), Scope: scope}
+	if claims, ok := CurrentClaims(c); ok && claims.ApiKeyID != 0 {
+		operator.ApiKeyScopes = claims.Scopes
+		if operator.ApiKeyScopes == nil {
+			operator.ApiKeyScopes = []string{}
+		}
+	}
+	c.Set(sessionStatus.OperatorAspect, operator)
+	return operator, nil
+}
+
+// EnforcePolicy 按访问策略校验当前用户能否执行路由所需权限对应的操作
+// 中间件中没有资源属性，包含资源条件的策略由业务方法调用impl.Policy.Enforce判断
+func EnforcePolicy(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operator, err := CurrentOperator(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		for _, permission := range permissions {
+			if err := impl.Policy.Enforce(operator, permission, nil); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, impl.ErrPolicyDenied) {
+					status = http.StatusForbidden
+				}
+				c.JSON(status, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
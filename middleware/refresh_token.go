@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/utils"
+)
+
+// TokenPair 访问令牌与刷新令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // 访问令牌有效期（秒）
+}
+
+// refreshTokenRecord Redis中保存的刷新令牌信息
+type refreshTokenRecord struct {
+	UserID              int64  `json:"userId"`
+	Email               string `json:"email"`
+	Role                string `json:"role"`
+	SessionID           string `json:"sessionId"`                // 所属登录会话，同一会话轮换出的刷新令牌属于同一令牌族
+	Pending             string `json:"pending"`                  // 待完成的操作，刷新后的token保持同样的限制
+	TokenVersion        int64  `json:"tokenVersion"`             // 登录时用户的token版本，版本递增后不能再刷新
+	ImpersonatorID      int64  `json:"impersonatorId,omitempty"` // 模拟登录时操作者的用户ID
+	ImpersonatorEmail   string `json:"impersonatorEmail,omitempty"`
+	ImpersonatorVersion int64  `json:"impersonatorVersion,omitempty"` // 模拟登录时操作者的token版本
+}
+
+// GenerateTokenPair 登录时创建会话，签发访问令牌和刷新令牌
+// 会话以登录token的jti为键，之后刷新得到的token通过sid声明关联到该会话
+func (m *AuthMiddleware) GenerateTokenPair(userID int64, email, role string, client SessionClient) (*TokenPair, error) {
+	return m.GenerateRestrictedTokenPair(userID, email, role, "", client)
+}
+
+// GenerateRestrictedTokenPair 登录时签发带待办操作的令牌对，令牌只能访问完成该操作所需的路由
+func (m *AuthMiddleware) GenerateRestrictedTokenPair(userID int64, email, role, pending string, client SessionClient) (*TokenPair, error) {
+	ctx := context.Background()
+	version, err := impl.TokenVersion.Current(userID)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := generateUniqueID()
+	if err := m.createSession(ctx, sessionID, userID, client); err != nil {
+		return nil, err
+	}
+	record := refreshTokenRecord{UserID: userID, Email: email, Role: role, SessionID: sessionID, Pending: pending, TokenVersion: version}
+	return m.issueTokenPair(ctx, record, sessionID)
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对，旧刷新令牌随即失效
+// 已使用过的刷新令牌被重放时视为泄露，吊销整个令牌族（即所属会话）
+func (m *AuthMiddleware) RefreshToken(refreshToken string) (*TokenPair, error) {
+	ctx := context.Background()
+	hash := hashRefreshToken(refreshToken)
+
+	var record refreshTokenRecord
+	if !utils.Redis.KEYEXISTSGetScan(ctx, refreshTokenKey(hash), &record) {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// 原子地标记为已使用，标记失败说明该令牌已被使用过
+	if !utils.Redis.SetStrNotExist(ctx, refreshUsedKey(hash), "1", int(m.refreshTTL.Seconds())) {
+		_ = m.revokeSession(ctx, record.UserID, record.SessionID)
+		return nil, errors.New("refresh token reuse detected, token family revoked")
+	}
+
+	if !m.sessionActive(ctx, record.SessionID) {
+		return nil, errors.New("refresh token has been revoked")
+	}
+	// 登录后修改了密码、角色等，token版本已递增
+	if version, err := impl.TokenVersion.Current(record.UserID); err != nil || version != record.TokenVersion {
+		_ = m.revokeSession(ctx, record.UserID, record.SessionID)
+		return nil, errors.New("refresh token has been revoked")
+	}
+	// 账户已停用或删除
+	var user dto.User
+	if err := impl.User.FindById(record.UserID, &user); err != nil || impl.User.CheckActive(&user) != nil {
+		_ = m.revokeSession(ctx, record.UserID, record.SessionID)
+		return nil, errors.New("refresh token has been revoked")
+	}
+
+	// 轮换：延长会话有效期并签发新的令牌对
+	if err := m.touchSession(ctx, record.SessionID, record.UserID); err != nil {
+		return nil, err
+	}
+	return m.issueTokenPair(ctx, record, generateUniqueID())
+}
+
+// RevokeRefreshToken 吊销刷新令牌所属的整个令牌族
+func (m *AuthMiddleware) RevokeRefreshToken(refreshToken string) error {
+	ctx := context.Background()
+	var record refreshTokenRecord
+	if !utils.Redis.KEYEXISTSGetScan(ctx, refreshTokenKey(hashRefreshToken(refreshToken)), &record) {
+		return errors.New("invalid refresh token")
+	}
+	return m.revokeSession(ctx, record.UserID, record.SessionID)
+}
+
+// issueTokenPair 签发访问令牌，并生成新的刷新令牌保存到Redis
+func (m *AuthMiddleware) issueTokenPair(ctx context.Context, record refreshTokenRecord, jti string) (*TokenPair, error) {
+	accessToken, err := m.generateToken(record, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	// 只保存刷新令牌的哈希，Redis泄露时无法直接使用
+	if err := utils.Redis.Set(ctx, refreshTokenKey(hashRefreshToken(refreshToken)), body, m.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(m.accessTTL.Seconds()),
+	}, nil
+}
+
+// randomToken 生成指定字节长度的随机令牌
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshTokenKey(hash string) string {
+	return fmt.Sprintf("refresh_token:%s", hash)
+}
+
+func refreshUsedKey(hash string) string {
+	return fmt.Sprintf("refresh_token_used:%s", hash)
+}
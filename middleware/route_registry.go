@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteMeta 路由元数据，注册路由时记录，鉴权中间件和路由列表接口都以此为准
+type RouteMeta struct {
+	Method            string   `json:"method"`
+	Path              string   `json:"path"`
+	Public            bool     `json:"public"`                // 公开访问，不需要登录
+	Permissions       []string `json:"permissions,omitempty"` // 需要同时拥有的权限
+	DenyApiKey        bool     `json:"denyApiKey"`            // 不允许通过API密钥访问
+	DenyImpersonation bool     `json:"denyImpersonation"`     // 不允许在模拟登录期间访问
+	Description       string   `json:"description"`
+}
+
+// Public 公开访问的路由
+func Public(description string) RouteMeta {
+	return RouteMeta{Public: true, Description: description}
+}
+
+// Authenticated 登录后即可访问的路由
+// 这类路由不需要权限，API密钥的scopes无法约束，因此不允许通过API密钥访问
+func Authenticated(description string) RouteMeta {
+	return RouteMeta{Description: description}
+}
+
+// Permission 需要指定权限才能访问的路由
+func Permission(permission, description string) RouteMeta {
+	return RouteMeta{Permissions: []string{permission}, Description: description}
+}
+
+// NoApiKey 不允许通过API密钥访问
+func (m RouteMeta) NoApiKey() RouteMeta {
+	m.DenyApiKey = true
+	return m
+}
+
+// NoImpersonation 不允许在模拟登录期间访问
+func (m RouteMeta) NoImpersonation() RouteMeta {
+	m.DenyImpersonation = true
+	return m
+}
+
+// Sensitive 账户安全相关的路由（密码、双因素认证、会话、API密钥等），只能由用户本人使用登录token访问
+func (m RouteMeta) Sensitive() RouteMeta {
+	return m.NoApiKey().NoImpersonation()
+}
+
+// RouteRegistry 路由元数据注册表
+type RouteRegistry struct {
+	mu     sync.RWMutex
+	routes map[string]RouteMeta
+}
+
+// Routes 全局路由注册表
+var Routes = &RouteRegistry{routes: map[string]RouteMeta{}}
+
+// register 记录路由元数据，同一路由重复注册时以后注册的为准
+func (r *RouteRegistry) register(meta RouteMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[routeKey(meta.Method, meta.Path)] = meta
+}
+
+// Lookup 根据请求方法和路由模板（c.FullPath()）查找路由元数据
+func (r *RouteRegistry) Lookup(method, fullPath string) (RouteMeta, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	meta, ok := r.routes[routeKey(method, fullPath)]
+	return meta, ok
+}
+
+// IsPublic 路由是否公开访问，未注册的路由一律需要鉴权
+func (r *RouteRegistry) IsPublic(method, fullPath string) bool {
+	meta, ok := r.Lookup(method, fullPath)
+	return ok && meta.Public
+}
+
+// List 按路径和方法排序返回全部路由元数据
+func (r *RouteRegistry) List() []RouteMeta {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]RouteMeta, 0, len(r.routes))
+	for _, meta := range r.routes {
+		routes = append(routes, meta)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func routeKey(method, fullPath string) string {
+	return method + " " + fullPath
+}
+
+// Router 包装gin路由组，注册路由时同时记录元数据，并按元数据添加权限校验等中间件
+type Router struct {
+	group             *gin.RouterGroup
+	registry          *RouteRegistry
+	denyApiKey        bool
+	denyImpersonation bool
+}
+
+// NewRouter 创建根路由
+func NewRouter(engine *gin.Engine) *Router {
+	return &Router{group: &engine.RouterGroup, registry: Routes}
+}
+
+// Group 创建子路由组
+func (r *Router) Group(relativePath string, handlers ...gin.HandlerFunc) *Router {
+	return &Router{
+		group:             r.group.Group(relativePath, handlers...),
+		registry:          r.registry,
+		denyApiKey:        r.denyApiKey,
+		denyImpersonation: r.denyImpersonation,
+	}
+}
+
+// Sensitive 组内所有路由都只能由用户本人使用登录token访问，见RouteMeta.Sensitive
+func (r *Router) Sensitive() *Router {
+	return &Router{group: r.group, registry: r.registry, denyApiKey: true, denyImpersonation: true}
+}
+
+// Use 添加组中间件
+func (r *Router) Use(middleware ...gin.HandlerFunc) {
+	r.group.Use(middleware...)
+}
+
+// Handle 注册路由并记录元数据
+func (r *Router) Handle(method, relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	meta.Method = method
+	meta.Path = joinPaths(r.group.BasePath(), relativePath)
+	meta.DenyApiKey = meta.DenyApiKey || r.denyApiKey
+	meta.DenyImpersonation = meta.DenyImpersonation || r.denyImpersonation
+	if meta.Public {
+		meta.Permissions = nil
+		meta.DenyApiKey = false
+		meta.DenyImpersonation = false
+	} else if len(meta.Permissions) == 0 {
+		// API密钥只能访问scopes覆盖的权限，不需要权限的路由一律拒绝API密钥
+		meta.DenyApiKey = true
+	}
+
+	chain := make([]gin.HandlerFunc, 0, len(handlers)+4)
+	if meta.DenyApiKey {
+		chain = append(chain, DenyApiKey())
+	}
+	if meta.DenyImpersonation {
+		chain = append(chain, DenyImpersonation())
+	}
+	if len(meta.Permissions) > 0 {
+		chain = append(chain, RequirePermission(meta.Permissions...), EnforcePolicy(meta.Permissions...))
+	}
+	chain = append(chain, handlers...)
+
+	r.registry.register(meta)
+	r.group.Handle(method, relativePath, chain...)
+}
+
+func (r *Router) GET(relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodGet, relativePath, meta, handlers...)
+}
+
+func (r *Router) POST(relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPost, relativePath, meta, handlers...)
+}
+
+func (r *Router) PUT(relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPut, relativePath, meta, handlers...)
+}
+
+func (r *Router) PATCH(relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPatch, relativePath, meta, handlers...)
+}
+
+func (r *Router) DELETE(relativePath string, meta RouteMeta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodDelete, relativePath, meta, handlers...)
+}
+
+// joinPaths 与gin拼接路由组路径的规则一致，保留结尾的斜杠
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if relativePath[len(relativePath)-1] == '/' && finalPath[len(finalPath)-1] != '/' {
+		return finalPath + "/"
+	}
+	return finalPath
+}
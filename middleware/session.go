@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tiny-admin-api-serve/entity/dto"
+	"tiny-admin-api-serve/enums/sessionStatus"
+	"tiny-admin-api-serve/utils"
+
+	"github.com/mileusna/useragent"
+)
+
+// SessionClient 登录客户端信息
+type SessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+// createSession 记录登录会话，会话以登录时签发token的jti为键，有效期与刷新令牌一致
+func (m *AuthMiddleware) createSession(ctx context.Context, sessionID string, userID int64, client SessionClient) error {
+	ua := useragent.Parse(client.UserAgent)
+	values := map[string]interface{}{
+		sessionStatus.UserId:    userID,
+		sessionStatus.IpAddr:    client.IP,
+		sessionStatus.Os:        strings.TrimSpace(ua.OS + " " + ua.OSVersion),
+		sessionStatus.Browser:   strings.TrimSpace(ua.Name + " " + ua.Version),
+		sessionStatus.LoginTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err := utils.Redis.HSetAll(ctx, sessionKey(sessionID), values, m.refreshTTL); err != nil {
+		return err
+	}
+	if err := utils.Redis.SAdd(ctx, userSessionsKey(userID), sessionID); err != nil {
+		return err
+	}
+	return utils.Redis.SetExpire(ctx, userSessionsKey(userID), m.refreshTTL)
+}
+
+// touchSession 刷新令牌时延长会话有效期
+func (m *AuthMiddleware) touchSession(ctx context.Context, sessionID string, userID int64) error {
+	if err := utils.Redis.SetExpire(ctx, sessionKey(sessionID), m.refreshTTL); err != nil {
+		return err
+	}
+	return utils.Redis.SetExpire(ctx, userSessionsKey(userID), m.refreshTTL)
+}
+
+// sessionActive 会话是否仍然有效
+func (m *AuthMiddleware) sessionActive(ctx context.Context, sessionID string) bool {
+	return utils.Redis.Exists(ctx, sessionKey(sessionID))
+}
+
+// ListSessions 获取用户的全部有效会话，currentSessionID对应的会话标记为当前会话
+func (m *AuthMiddleware) ListSessions(userID int64, currentSessionID string) ([]dto.SessionVo, error) {
+	ctx := context.Background()
+	sessionIDs, err := utils.Redis.SMembers(ctx, userSessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]dto.SessionVo, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		values, err := utils.Redis.HGetAll(ctx, sessionKey(sessionID))
+		if err != nil {
+			return nil, err
+		}
+		// 会话已过期或被吊销，顺便清理索引
+		if len(values) == 0 {
+			_ = utils.Redis.SRem(ctx, userSessionsKey(userID), sessionID)
+			continue
+		}
+		sessions = append(sessions, dto.SessionVo{
+			ID:        sessionID,
+			IpAddr:    values[sessionStatus.IpAddr],
+			Os:        values[sessionStatus.Os],
+			Browser:   values[sessionStatus.Browser],
+			LoginTime: values[sessionStatus.LoginTime],
+			Current:   sessionID == currentSessionID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LoginTime > sessions[j].LoginTime
+	})
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的指定会话，会话不属于该用户时返回错误
+func (m *AuthMiddleware) RevokeSession(userID int64, sessionID string) error {
+	ctx := context.Background()
+	values, err := utils.Redis.HGetAll(ctx, sessionKey(sessionID))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 || values[sessionStatus.UserId] != strconv.FormatInt(userID, 10) {
+		return errors.New("session not found")
+	}
+	return m.revokeSession(ctx, userID, sessionID)
+}
+
+// RevokeAllSessions 吊销用户除exceptSessionID外的全部会话，返回吊销数量
+func (m *AuthMiddleware) RevokeAllSessions(userID int64, exceptSessionID string) (int, error) {
+	ctx := context.Background()
+	sessionIDs, err := utils.Redis.SMembers(ctx, userSessionsKey(userID))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, sessionID := range sessionIDs {
+		if sessionID == exceptSessionID {
+			continue
+		}
+		if err := m.revokeSession(ctx, userID, sessionID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// revokeSession 删除会话，会话下的访问令牌和刷新令牌随之失效
+func (m *AuthMiddleware) revokeSession(ctx context.Context, userID int64, sessionID string) error {
+	if err := utils.Redis.DelByKey(ctx, sessionKey(sessionID)); err != nil {
+		return err
+	}
+	return utils.Redis.SRem(ctx, userSessionsKey(userID), sessionID)
+}
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+func userSessionsKey(userID int64) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
@@ -2,6 +2,7 @@ package routers
 
 import (
 	"tiny-admin-api-serve/controller"
+	"tiny-admin-api-serve/middleware"
 	"tiny-admin-api-serve/utils/elastic"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,44 @@ type CrudRouterConfig[T any] struct {
 	Apis        []elastic.Api                 // 支持的API操作
 	Middlewares []gin.HandlerFunc             // 中间件列表
 	Controller  *controller.CrudController[T] // 控制器实例
+	Permission  string                        // 权限前缀，如"user"，每个API按操作类型校验"user::add"等权限，为空则不校验
+}
+
+// crudPermissionActions API操作对应的权限动作
+var crudPermissionActions = map[elastic.Api]string{
+	elastic.ApiCreate:      "add",
+	elastic.ApiGet:         "query",
+	elastic.ApiUpdate:      "update",
+	elastic.ApiUpdateById:  "update",
+	elastic.ApiDelete:      "remove",
+	elastic.ApiBatchDelete: "batch-remove",
+	elastic.ApiList:        "query",
+	elastic.ApiPage:        "query",
+	elastic.ApiCount:       "query",
+	elastic.ApiExport:      "export",
+}
+
+// crudDescriptions API操作的描述
+var crudDescriptions = map[elastic.Api]string{
+	elastic.ApiCreate:      "创建",
+	elastic.ApiGet:         "根据ID获取",
+	elastic.ApiUpdate:      "更新",
+	elastic.ApiUpdateById:  "根据ID更新",
+	elastic.ApiDelete:      "根据ID删除",
+	elastic.ApiBatchDelete: "批量删除",
+	elastic.ApiList:        "查询列表",
+	elastic.ApiPage:        "分页查询",
+	elastic.ApiCount:       "统计数量",
+	elastic.ApiExport:      "导出",
+}
+
+// routeMeta 指定API操作的路由元数据，配置了权限前缀时按操作类型校验权限
+func routeMeta[T any](config CrudRouterConfig[T], api elastic.Api) middleware.RouteMeta {
+	description := config.Path + " " + crudDescriptions[api]
+	if config.Permission == "" {
+		return middleware.Authenticated(description)
+	}
+	return middleware.Permission(config.Permission+"::"+crudPermissionActions[api], description)
 }
 
 // RegisterCrudRoutes 注册CRUD路由
@@ -27,7 +66,7 @@ func RegisterCrudRoutes[T any](engine *gin.Engine, config CrudRouterConfig[T]) e
 	}
 
 	// 创建路由组
-	group := engine.Group(config.Path)
+	group := middleware.NewRouter(engine).Group(config.Path)
 
 	// 添加中间件
 	for _, middleware := range config.Middlewares {
@@ -36,46 +75,46 @@ func RegisterCrudRoutes[T any](engine *gin.Engine, config CrudRouterConfig[T]) e
 
 	// 注册路由
 	if elastic.ApiCreate.Contains(config.Apis) {
-		group.POST("", config.Controller.Create)
+		group.POST("", routeMeta(config, elastic.ApiCreate), config.Controller.Create)
 	}
 
 	if elastic.ApiUpdate.Contains(config.Apis) {
-		group.PUT("", config.Controller.Update)
+		group.PUT("", routeMeta(config, elastic.ApiUpdate), config.Controller.Update)
 	}
 
 	if elastic.ApiBatchDelete.Contains(config.Apis) {
-		group.DELETE("/batch", config.Controller.BatchDelete)
+		group.DELETE("/batch", routeMeta(config, elastic.ApiBatchDelete), config.Controller.BatchDelete)
 	}
 
 	// 将带具体路径的GET请求放在前面注册
 	if elastic.ApiList.Contains(config.Apis) {
-		group.GET("", config.Controller.List)
+		group.GET("", routeMeta(config, elastic.ApiList), config.Controller.List)
 	}
 
 	if elastic.ApiPage.Contains(config.Apis) {
-		group.GET("/page", config.Controller.Page)
+		group.GET("/page", routeMeta(config, elastic.ApiPage), config.Controller.Page)
 	}
 
 	if elastic.ApiCount.Contains(config.Apis) {
-		group.GET("/count", config.Controller.Count)
+		group.GET("/count", routeMeta(config, elastic.ApiCount), config.Controller.Count)
 	}
 	if elastic.ApiExport.Contains(config.Apis) {
 		// 导出功能需要额外实现
-		group.GET("/export", func(c *gin.Context) {
+		group.GET("/export", routeMeta(config, elastic.ApiExport), func(c *gin.Context) {
 			c.JSON(200, gin.H{"message": "Export not implemented yet"})
 		})
 	}
 	// 将带参数的路由放在最后注册，避免冲突
 	if elastic.ApiGet.Contains(config.Apis) {
-		group.GET("/:id", config.Controller.GetById)
+		group.GET("/:id", routeMeta(config, elastic.ApiGet), config.Controller.GetById)
 	}
 
 	if elastic.ApiUpdateById.Contains(config.Apis) {
-		group.PATCH("/:id", config.Controller.UpdateById)
+		group.PATCH("/:id", routeMeta(config, elastic.ApiUpdateById), config.Controller.UpdateById)
 	}
 
 	if elastic.ApiDelete.Contains(config.Apis) {
-		group.DELETE("/:id", config.Controller.Delete)
+		group.DELETE("/:id", routeMeta(config, elastic.ApiDelete), config.Controller.Delete)
 	}
 
 	return nil
@@ -89,3 +128,13 @@ func RegisterDefaultCrudRoutes[T any](engine *gin.Engine, path string, middlewar
 		Middlewares: middlewares,
 	})
 }
+
+// RegisterPermissionCrudRoutes 注册默认的CRUD路由（包含所有API操作），并按权限前缀校验每个操作
+func RegisterPermissionCrudRoutes[T any](engine *gin.Engine, path string, permission string, middlewares ...gin.HandlerFunc) error {
+	return RegisterCrudRoutes(engine, CrudRouterConfig[T]{
+		Path:        path,
+		Apis:        elastic.AllApis,
+		Middlewares: middlewares,
+		Permission:  permission,
+	})
+}
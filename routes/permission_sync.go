@@ -0,0 +1,42 @@
+package routers
+
+import (
+	"log"
+	"strings"
+	"tiny-admin-api-serve/impl"
+	"tiny-admin-api-serve/middleware"
+	"tiny-admin-api-serve/setting"
+)
+
+// SyncPermissions 按已注册路由所需的权限同步权限表，需在注册全部路由后调用
+// 创建缺少的权限，报告没有任何路由使用的权限；配置了permission_sync.admin_role时将新建的权限授予该角色
+func SyncPermissions() error {
+	required := map[string]string{}
+	for _, route := range middleware.Routes.List() {
+		for _, permission := range route.Permissions {
+			// 多个路由使用同一权限时以第一个路由的描述为准
+			if _, ok := required[permission]; !ok {
+				required[permission] = route.Description
+			}
+		}
+	}
+
+	adminRole := ""
+	if setting.Conf.PermissionSync != nil {
+		adminRole = setting.Conf.PermissionSync.AdminRole
+	}
+	result, err := impl.Permission.Sync(required, adminRole)
+	if err != nil {
+		return err
+	}
+	if len(result.Created) > 0 {
+		log.Printf("created permissions from routes: %s", strings.Join(result.Created, ", "))
+	}
+	if len(result.Granted) > 0 {
+		log.Printf("granted new permissions to role %s", adminRole)
+	}
+	if len(result.Orphaned) > 0 {
+		log.Printf("permissions not used by any route: %s", strings.Join(result.Orphaned, ", "))
+	}
+	return nil
+}
@@ -4,97 +4,174 @@ import (
 	"tiny-admin-api-serve/controller"
 	"tiny-admin-api-serve/entity/dto"
 	"tiny-admin-api-serve/middleware"
+
 	"github.com/gin-gonic/gin"
 )
 
 // RouterUser 用户路由
+// 所有路由通过middleware.Router注册，注册时记录是否公开、所需权限和描述，鉴权中间件据此放行或校验
 func RouterUser(engine *gin.Engine) {
+	router := middleware.NewRouter(engine)
+
 	// 认证相关路由
 	authController := controller.NewAuthController()
-	authGroup := engine.Group("/auth")
+	router.GET("/.well-known/jwks.json", middleware.Public("获取token验证公钥（JWKS）"), authController.Jwks)
+	authGroup := router.Group("/auth")
 	{
-		authGroup.POST("/login", middleware.IsPublic(), authController.Login)
-		authGroup.POST("/register", middleware.IsPublic(), authController.Register)
-		authGroup.GET("/profile", authController.Profile)
-		authGroup.POST("/logout", authController.Logout)
-		authGroup.POST("/refresh", authController.Refresh)
+		authGroup.POST("/login", middleware.Public("账户密码登录"), authController.Login)
+		authGroup.POST("/login/2fa", middleware.Public("登录第二步，校验双因素验证码"), authController.LoginTwoFactor)
+		authGroup.GET("/oidc/login", middleware.Public("发起单点登录"), authController.OidcLogin)
+		authGroup.GET("/oidc/callback", middleware.Public("单点登录回调"), authController.OidcCallback)
+		authGroup.POST("/oidc/token", middleware.Public("使用单点登录的一次性登录码换取token"), authController.OidcToken)
+		authGroup.POST("/2fa/setup", middleware.Authenticated("生成双因素认证密钥").Sensitive(), authController.SetupTwoFactor)
+		authGroup.POST("/2fa/confirm", middleware.Authenticated("确认绑定双因素认证").Sensitive(), authController.ConfirmTwoFactor)
+		authGroup.POST("/2fa/disable", middleware.Authenticated("关闭双因素认证").Sensitive(), authController.DisableTwoFactor)
+		authGroup.POST("/register", middleware.Public("自助注册"), authController.Register)
+		authGroup.POST("/verify", middleware.Public("验证注册邮箱"), authController.VerifyEmail)
+		authGroup.POST("/verify/resend", middleware.Public("重新发送邮箱验证邮件"), authController.ResendVerifyEmail)
+		authGroup.GET("/profile", middleware.Authenticated("获取当前登录用户"), authController.Profile)
+		authGroup.POST("/logout", middleware.Authenticated("退出登录"), authController.Logout)
+		authGroup.POST("/logout/all", middleware.Authenticated("退出全部设备").Sensitive(), authController.LogoutEverywhere)
+		authGroup.POST("/refresh", middleware.Public("使用刷新令牌换取新的令牌对"), authController.Refresh)
+		authGroup.POST("/forgot", middleware.Public("找回密码，发送重置邮件"), authController.ForgotPassword)
+		authGroup.POST("/reset", middleware.Public("使用重置令牌设置新密码"), authController.ResetPassword)
+	}
+	// 模拟登录相关路由，模拟登录期间不能再次发起模拟登录
+	impersonationController := controller.NewImpersonationController()
+	impersonateGroup := router.Group("/auth/impersonate")
+	{
+		impersonateGroup.POST("/stop", middleware.Authenticated("结束模拟登录"), impersonationController.Stop)
+		impersonateGroup.GET("/logs", middleware.Permission("user::impersonate", "查询模拟登录审计日志"), impersonationController.GetLogs)
+		impersonateGroup.POST("/:userId", middleware.Permission("user::impersonate", "以指定用户身份登录").Sensitive(), impersonationController.Start)
+	}
+	// 登录会话相关路由
+	sessionController := controller.NewSessionController()
+	sessionGroup := router.Group("/session").Sensitive()
+	{
+		sessionGroup.GET("", middleware.Authenticated("获取当前用户的登录会话"), sessionController.GetSessions)
+		sessionGroup.DELETE("/others", middleware.Authenticated("吊销当前会话以外的全部会话"), sessionController.RevokeOtherSessions)
+		sessionGroup.DELETE("/:id", middleware.Authenticated("吊销当前用户的指定会话"), sessionController.RevokeSession)
+		sessionGroup.DELETE("/user/:userId", middleware.Permission("session::remove", "吊销指定用户的全部会话"), sessionController.RevokeUserSessions)
+	}
+	// API密钥相关路由，只能使用登录token管理
+	apiKeyController := controller.NewApiKeyController()
+	apiKeyGroup := router.Group("/apikey").Sensitive()
+	{
+		apiKeyGroup.GET("", middleware.Authenticated("获取当前用户的API密钥"), apiKeyController.GetApiKeys)
+		apiKeyGroup.POST("", middleware.Authenticated("创建API密钥"), apiKeyController.CreateApiKey)
+		apiKeyGroup.DELETE("/:id", middleware.Authenticated("吊销API密钥"), apiKeyController.DeleteApiKey)
 	}
 	userController := controller.NewUserController()
 	// 用户相关路由
-	userGroup := engine.Group("/user")
+	userGroup := router.Group("/user")
 	{
-		userGroup.POST("/reg", userController.Register)
-		userGroup.GET("/info/:email", userController.GetUserInfo)
-		userGroup.GET("/info", userController.GetUserInfo)
-		userGroup.GET("/info/", userController.GetUserInfo)
-		userGroup.GET("/info/:email/", userController.GetUserInfo)
-		userGroup.DELETE("/:email", userController.DelUser)
-		userGroup.PATCH("/update", userController.UpdateUser)
-		userGroup.GET("", userController.GetAllUser)
-		userGroup.PATCH("/admin/updatePwd", userController.UpdatePwdAdmin)
-		userGroup.PATCH("/updatePwd", userController.UpdatePwdUser)
-		userGroup.POST("/batch", userController.BatchRemoveUser)
+		userGroup.POST("/reg", middleware.Permission("user::add", "创建用户"), userController.Register)
+		userGroup.GET("/info/:email", middleware.Permission("user::query", "获取指定用户信息"), userController.GetUserInfo)
+		userGroup.GET("/info", middleware.Authenticated("获取当前用户信息"), userController.GetUserInfo)
+		userGroup.GET("/info/", middleware.Authenticated("获取当前用户信息"), userController.GetUserInfo)
+		userGroup.GET("/info/:email/", middleware.Permission("user::query", "获取指定用户信息"), userController.GetUserInfo)
+		userGroup.DELETE("/:email", middleware.Permission("user::remove", "删除用户"), userController.DelUser)
+		userGroup.PATCH("/update", middleware.Permission("user::update", "更新用户信息"), userController.UpdateUser)
+		userGroup.GET("", middleware.Permission("user::query", "分页查询用户"), userController.GetAllUser)
+		userGroup.PATCH("/admin/updatePwd", middleware.Permission("user::password::force-update", "管理员强制修改密码").NoImpersonation(), userController.UpdatePwdAdmin)
+		userGroup.PATCH("/updatePwd", middleware.Authenticated("修改自己的密码").Sensitive(), userController.UpdatePwdUser)
+		userGroup.POST("/batch", middleware.Permission("user::batch-remove", "批量删除用户"), userController.BatchRemoveUser)
+		userGroup.POST("/unlock", middleware.Permission("user::unlock", "解除登录锁定"), userController.UnlockUser)
+		userGroup.POST("/roles/assign", middleware.Permission("user::assign-role", "为多个用户批量添加角色"), userController.AssignRoles)
+		userGroup.POST("/roles/unassign", middleware.Permission("user::assign-role", "批量移除多个用户的角色"), userController.UnassignRoles)
 	}
 
 	// 角色相关路由
 	roleController := controller.NewRoleController()
-	roleGroup := engine.Group("/role")
+	roleGroup := router.Group("/role")
 	{
-		roleGroup.POST("", roleController.Create)
-		roleGroup.GET("", roleController.GetAllRole)
-		roleGroup.GET("/detail", roleController.GetAllRoleDetail)
-		roleGroup.PATCH("", roleController.UpdateRole)
-		roleGroup.DELETE("/:id", roleController.DeleteRole)
-		roleGroup.GET("/info/:id", roleController.GetRoleInfo)
+		roleGroup.POST("", middleware.Permission("role::add", "创建角色"), roleController.Create)
+		roleGroup.GET("", middleware.Permission("role::query", "查询全部角色"), roleController.GetAllRole)
+		roleGroup.GET("/detail", middleware.Permission("role::query", "查询角色详情（含权限和菜单）"), roleController.GetAllRoleDetail)
+		roleGroup.PATCH("", middleware.Permission("role::update", "更新角色"), roleController.UpdateRole)
+		roleGroup.DELETE("/:id", middleware.Permission("role::remove", "删除角色"), roleController.DeleteRole)
+		roleGroup.GET("/info/:id", middleware.Permission("role::query", "获取角色信息"), roleController.GetRoleInfo)
+		roleGroup.POST("/:id/permission/:permissionId", middleware.Permission("role::update", "为角色添加权限"), roleController.AddPermission)
+		roleGroup.DELETE("/:id/permission/:permissionId", middleware.Permission("role::update", "移除角色的权限"), roleController.RemovePermission)
+		roleGroup.POST("/:id/menu/:menuId", middleware.Permission("role::update", "为角色添加菜单"), roleController.AddMenu)
+		roleGroup.DELETE("/:id/menu/:menuId", middleware.Permission("role::update", "移除角色的菜单"), roleController.RemoveMenu)
 	}
 
 	// 菜单相关路由
 	menuController := controller.NewMenuController()
-	menuGroup := engine.Group("/menu")
+	menuGroup := router.Group("/menu")
 	{
-		menuGroup.GET("/role/:email", menuController.GetMenus)
-		menuGroup.POST("", menuController.Create)
-		menuGroup.GET("", menuController.GetAll)
-		menuGroup.PATCH("", menuController.Update)
-		menuGroup.DELETE("/:id", menuController.Delete)
+		menuGroup.GET("/role/:email", middleware.Authenticated("获取当前用户的菜单"), menuController.GetMenus)
+		menuGroup.POST("", middleware.Permission("menu::add", "创建菜单"), menuController.Create)
+		menuGroup.GET("", middleware.Permission("menu::query", "查询全部菜单"), menuController.GetAll)
+		menuGroup.PATCH("", middleware.Permission("menu::update", "更新菜单"), menuController.Update)
+		menuGroup.DELETE("/:id", middleware.Permission("menu::remove", "删除菜单"), menuController.Delete)
+	}
+
+	// 部门相关路由
+	deptController := controller.NewDeptController()
+	deptGroup := router.Group("/dept")
+	{
+		deptGroup.GET("", middleware.Permission("dept::query", "获取部门树"), deptController.GetTree)
+		deptGroup.POST("", middleware.Permission("dept::add", "创建部门"), deptController.Create)
+		deptGroup.PATCH("", middleware.Permission("dept::update", "更新部门"), deptController.Update)
+		deptGroup.DELETE("/:id", middleware.Permission("dept::remove", "删除部门"), deptController.Delete)
+	}
+
+	// 访问策略相关路由
+	policyController := controller.NewPolicyController()
+	policyGroup := router.Group("/policy")
+	{
+		policyGroup.GET("", middleware.Permission("policy::query", "查询全部访问策略"), policyController.GetAll)
+		policyGroup.POST("", middleware.Permission("policy::add", "创建访问策略"), policyController.Create)
+		policyGroup.PATCH("", middleware.Permission("policy::update", "更新访问策略"), policyController.Update)
+		policyGroup.DELETE("/:id", middleware.Permission("policy::remove", "删除访问策略"), policyController.Delete)
 	}
 
 	// 权限相关路由
 	permissionController := controller.NewPermissionController()
-	permissionGroup := engine.Group("/permission")
+	permissionGroup := router.Group("/permission")
 	{
-		permissionGroup.POST("", permissionController.Create)
-		permissionGroup.GET("", permissionController.GetAll)
-		permissionGroup.PATCH("", permissionController.Update)
-		permissionGroup.DELETE("/:id", permissionController.Delete)
+		permissionGroup.POST("", middleware.Permission("permission::add", "创建权限"), permissionController.Create)
+		permissionGroup.GET("", middleware.Permission("permission::query", "查询全部权限"), permissionController.GetAll)
+		permissionGroup.GET("/expand", middleware.Permission("permission::query", "展开通配符权限覆盖的具体权限"), permissionController.Expand)
+		permissionGroup.PATCH("", middleware.Permission("permission::update", "更新权限"), permissionController.Update)
+		permissionGroup.DELETE("/:id", middleware.Permission("permission::remove", "删除权限"), permissionController.Delete)
 	}
 
 	// i18n相关路由
 	i18Controller := controller.NewI18Controller()
-	i18Group := engine.Group("/i18")
+	i18Group := router.Group("/i18")
 	{
-		i18Group.POST("", i18Controller.CreateI18Dto)
-		i18Group.GET("/format", i18Controller.GetFormat)
-		i18Group.GET("", i18Controller.FindAll)
-		i18Group.GET("/:id", i18Controller.FindOne)
-		i18Group.PATCH("/:id", i18Controller.Update)
-		i18Group.DELETE("/:id", i18Controller.Remove)
-		i18Group.POST("/batch", i18Controller.BatchRemove)
+		i18Group.POST("", middleware.Permission("i18n::add", "创建词条"), i18Controller.CreateI18Dto)
+		i18Group.GET("/format", middleware.Authenticated("获取格式化的词条"), i18Controller.GetFormat)
+		i18Group.GET("", middleware.Permission("i18n::query", "分页查询词条"), i18Controller.FindAll)
+		i18Group.GET("/:id", middleware.Permission("i18n::query", "获取词条"), i18Controller.FindOne)
+		i18Group.PATCH("/:id", middleware.Permission("i18n::update", "更新词条"), i18Controller.Update)
+		i18Group.DELETE("/:id", middleware.Permission("i18n::remove", "删除词条"), i18Controller.Remove)
+		i18Group.POST("/batch", middleware.Permission("i18n::batch-remove", "批量删除词条"), i18Controller.BatchRemove)
 	}
 
 	// 语言相关路由
 	langController := controller.NewLangController()
-	langGroup := engine.Group("/lang")
+	langGroup := router.Group("/lang")
+	{
+		langGroup.POST("", middleware.Permission("lang::add", "创建语言"), langController.CreateLang)
+		langGroup.GET("", middleware.Permission("lang::query", "查询全部语言"), langController.FindAllLang)
+		langGroup.PATCH("/:id", middleware.Permission("lang::update", "更新语言"), langController.UpdateLang)
+		langGroup.DELETE("/:id", middleware.Permission("lang::remove", "删除语言"), langController.RemoveLang)
+	}
+
+	// 系统相关路由
+	routeController := controller.NewRouteController()
+	systemGroup := router.Group("/system")
 	{
-		langGroup.POST("", langController.CreateLang)
-		langGroup.GET("", langController.FindAllLang)
-		langGroup.PATCH("/:id", langController.UpdateLang)
-		langGroup.DELETE("/:id", langController.RemoveLang)
+		systemGroup.GET("/routes", middleware.Permission("route::query", "列出全部路由及访问规则"), routeController.GetRoutes)
 	}
 
 	// 示例：使用通用CRUD路由注册功能
-	// 方式1：注册默认的所有CRUD路由
-	RegisterDefaultCrudRoutes[dto.User](engine, "/api/user", middleware.IsPublic())
+	// 方式1：注册默认的所有CRUD路由，并按"user::*"系列权限校验
+	RegisterPermissionCrudRoutes[dto.User](engine, "/api/user", "user")
 
 	// 方式2：自定义注册指定的CRUD路由
 	// RegisterCrudRoutes[dto.User](engine, CrudRouterConfig[dto.User]{
@@ -107,7 +184,7 @@ func RouterUser(engine *gin.Engine) {
 	// 		elastic.ApiPage,
 	// 		elastic.ApiCount,
 	// 	},
-	// 	Middlewares: []gin.HandlerFunc{middleware.IsPublic()},
+	// 	Permission: "user",
 	// })
 
 }
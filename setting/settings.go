@@ -9,23 +9,140 @@ import (
 var Conf = new(AppConfig)
 
 type AppConfig struct {
-	Name         string `mapstructure:"name"`
-	Mode         string `mapstructure:"mode"`
-	Version      string `mapstructure:"version"`
-	StartTime    string `mapstructure:"start_time"`
-	Port         int    `mapstructure:"port"`
-	Host         string `mapstructure:"host"`
-	Cluster      bool   `mapstructure:"cluster"`
-	*TokenConfig `mapstructure:"token"`
-	*LogConfig   `mapstructure:"log"`
-	*Datasource  `mapstructure:"datasource"`
-	*UploadFile  `mapstructure:"upload_file"`
+	Name            string   `mapstructure:"name"`
+	Mode            string   `mapstructure:"mode"`
+	Version         string   `mapstructure:"version"`
+	StartTime       string   `mapstructure:"start_time"`
+	Port            int      `mapstructure:"port"`
+	Host            string   `mapstructure:"host"`
+	Cluster         bool     `mapstructure:"cluster"`
+	TrustedProxies  []string `mapstructure:"trusted_proxies"`  // 可信的反向代理，只有来自这些地址的请求才读取X-Forwarded-For
+	TrustedPlatform string   `mapstructure:"trusted_platform"` // CDN或云平台提供客户端IP的请求头
+	*TokenConfig    `mapstructure:"token"`
+	*LoginConfig    `mapstructure:"login"`
+	*PasswordPolicy `mapstructure:"password_policy"`
+	*PasswordReset  `mapstructure:"password_reset"`
+	*MailConfig     `mapstructure:"mail"`
+	*RegisterConfig `mapstructure:"register"`
+	*OidcConfig     `mapstructure:"oidc"`
+	*AuthConfig     `mapstructure:"auth"`
+	*PermissionSync `mapstructure:"permission_sync"`
+	*LdapConfig     `mapstructure:"ldap"`
+	*LogConfig      `mapstructure:"log"`
+	*Datasource     `mapstructure:"datasource"`
+	*UploadFile     `mapstructure:"upload_file"`
 }
 
 type TokenConfig struct {
-	ExpireTime int64  `mapstructure:"expire_time"`
-	Secret     string `mapstructure:"secret"`
-	Issuer     string `mapstructure:"issuer"`
+	ExpireTime        int64  `mapstructure:"expire_time"`         // 访问令牌有效期（分钟）
+	RefreshExpireTime int64  `mapstructure:"refresh_expire_time"` // 刷新令牌有效期（分钟）
+	Secret            string `mapstructure:"secret"`
+	Issuer            string `mapstructure:"issuer"`
+}
+
+// LoginConfig 登录防暴力破解配置，账户和客户端IP分别计数
+type LoginConfig struct {
+	MaxFailures     int64 `mapstructure:"max_failures"`     // 单个账户在统计窗口内允许的失败次数
+	IpMaxFailures   int64 `mapstructure:"ip_max_failures"`  // 单个IP在统计窗口内允许的失败次数
+	FailureWindow   int64 `mapstructure:"failure_window"`   // 失败次数统计窗口（分钟）
+	LockoutDuration int64 `mapstructure:"lockout_duration"` // 达到阈值后的锁定时长（分钟）
+}
+
+// PasswordPolicy 密码策略配置
+type PasswordPolicy struct {
+	MinLength     int      `mapstructure:"min_length"`     // 最小长度
+	RequireUpper  bool     `mapstructure:"require_upper"`  // 必须包含大写字母
+	RequireLower  bool     `mapstructure:"require_lower"`  // 必须包含小写字母
+	RequireDigit  bool     `mapstructure:"require_digit"`  // 必须包含数字
+	RequireSymbol bool     `mapstructure:"require_symbol"` // 必须包含特殊字符
+	Denylist      []string `mapstructure:"denylist"`       // 禁止使用的常见密码（不区分大小写）
+	History       int      `mapstructure:"history"`        // 不能与最近N次使用过的密码相同
+	MaxAge        int      `mapstructure:"max_age"`        // 密码最长使用天数，0表示不过期
+}
+
+// PasswordReset 找回密码配置
+type PasswordReset struct {
+	TokenTTL int64  `mapstructure:"token_ttl"` // 重置令牌有效期（分钟）
+	URL      string `mapstructure:"url"`       // 前端重置密码页面地址，令牌以token参数附加在后面
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Type     string `mapstructure:"type"` // smtp 或 log（默认），log只写入文件或控制台，用于本地开发
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	LogPath  string `mapstructure:"log_path"` // log类型的输出文件，为空时打印到控制台
+}
+
+// RegisterConfig 自助注册配置
+type RegisterConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`         // 是否开放自助注册
+	DefaultRole    string   `mapstructure:"default_role"`    // 注册用户默认分配的角色名称，为空时不分配
+	AllowedDomains []string `mapstructure:"allowed_domains"` // 允许注册的邮箱域名，为空时不限制
+	VerifyTTL      int64    `mapstructure:"verify_ttl"`      // 邮箱验证令牌有效期（分钟）
+	VerifyURL      string   `mapstructure:"verify_url"`      // 前端邮箱验证页面地址，令牌以token参数附加在后面
+}
+
+// OidcConfig OpenID Connect 单点登录配置
+type OidcConfig struct {
+	Enabled      bool              `mapstructure:"enabled"`
+	Issuer       string            `mapstructure:"issuer"`        // IdP的issuer，用于发现配置并校验ID Token
+	DiscoveryURL string            `mapstructure:"discovery_url"` // 发现地址与issuer不同时配置（如本地容器中的模拟IdP），为空时使用issuer
+	ClientID     string            `mapstructure:"client_id"`
+	ClientSecret string            `mapstructure:"client_secret"`
+	RedirectURL  string            `mapstructure:"redirect_url"` // 回调地址，指向 /auth/oidc/callback
+	Scopes       []string          `mapstructure:"scopes"`       // 额外申请的scope，openid总会申请
+	GroupsClaim  string            `mapstructure:"groups_claim"` // ID Token中的组声明名称，默认groups
+	GroupRoles   map[string]string `mapstructure:"group_roles"`  // IdP组到本地角色名称的映射
+	AutoCreate   bool              `mapstructure:"auto_create"`  // 本地不存在时是否自动创建用户
+	DefaultRole  string            `mapstructure:"default_role"` // 自动创建且没有匹配到任何组时分配的角色
+	FrontendURL  string            `mapstructure:"frontend_url"` // 登录完成后跳转的前端地址，一次性登录码以code参数附加
+}
+
+// AuthConfig 账户密码登录的认证方式选择
+// 选择顺序：应急账户 -> 用户自身的认证方式（非本地时）-> 邮箱域名 -> 默认认证方式
+type AuthConfig struct {
+	DefaultProvider string           `mapstructure:"default_provider"` // 默认认证方式，local或ldap，默认local
+	DomainProviders []DomainProvider `mapstructure:"domain_providers"` // 按邮箱域名选择认证方式
+	BreakGlass      []string         `mapstructure:"break_glass"`      // 应急管理员邮箱，始终使用本地账户登录，LDAP不可用时仍可登录
+}
+
+// PermissionSync 启动时按已注册路由所需的权限同步权限表
+type PermissionSync struct {
+	AdminRole string `mapstructure:"admin_role"` // 新建的权限自动授予该角色，为空时不授予
+}
+
+// DomainProvider 邮箱域名对应的认证方式
+type DomainProvider struct {
+	Domain   string `mapstructure:"domain"`
+	Provider string `mapstructure:"provider"`
+}
+
+// LdapConfig LDAP / Active Directory 认证配置
+type LdapConfig struct {
+	URL                string      `mapstructure:"url"`                  // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool        `mapstructure:"start_tls"`            // ldap://连接是否升级为TLS
+	InsecureSkipVerify bool        `mapstructure:"insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
+	Timeout            int64       `mapstructure:"timeout"`              // 连接超时（秒）
+	BindDN             string      `mapstructure:"bind_dn"`              // 用于查找用户的服务账户
+	BindPassword       string      `mapstructure:"bind_password"`
+	BaseDN             string      `mapstructure:"base_dn"`
+	UserFilter         string      `mapstructure:"user_filter"` // 查找用户的过滤器，%s替换为登录邮箱
+	EmailAttr          string      `mapstructure:"email_attr"`  // 默认mail
+	NameAttr           string      `mapstructure:"name_attr"`   // 默认displayName
+	GroupAttr          string      `mapstructure:"group_attr"`  // 用户所属组DN的属性，默认memberOf
+	GroupRoles         []GroupRole `mapstructure:"group_roles"` // 组DN到本地角色名称的映射
+	AutoCreate         bool        `mapstructure:"auto_create"` // 首次登录时是否自动创建本地用户
+	DefaultRole        string      `mapstructure:"default_role"`
+}
+
+// GroupRole 组到本地角色的映射
+type GroupRole struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
 }
 
 type LogConfig struct {
@@ -49,7 +166,8 @@ type Mysql struct {
 	MaxIdleConns int    `mapstructure:"max_idle_conns"`
 }
 
-func init() {
+// Init 读取配置文件到Conf，启动时最先调用，其他组件的初始化依赖读取到的配置
+func Init() {
 	viper.SetConfigFile("./config/config.yaml")
 
 	err := viper.ReadInConfig() // 读取配置信息
@@ -18,16 +18,8 @@ type DBUtil struct {
 // Db  全局变量, 外部使用utils.Db来访问
 var Db DBUtil
 
-func init() {
-	viper.SetConfigFile("./config/config.yaml")
-
-	err := viper.ReadInConfig() // 读取配置信息
-	if err != nil {
-		// 读取配置信息失败
-		fmt.Printf("viper.ReadInConfig failed, err:%v\n", err)
-		panic(err)
-		return
-	}
+// InitDb 按datasource配置连接数据库，需在setting.Init读取配置后调用
+func InitDb() {
 	dbConfig := dto.DbConfig{
 		Driver:       viper.GetString("datasource.type"),
 		Host:         viper.GetString("datasource.host"),
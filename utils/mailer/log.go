@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LogMailer 不真正发送邮件，只把邮件内容追加到文件，未配置文件时打印到日志，用于本地开发
+type LogMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	content := fmt.Sprintf("----- %s -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), m.From, to, subject, body)
+	if m.Path == "" {
+		log.Print("[mailer] " + content)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(content)
+	return err
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"errors"
+	"sync"
+	"tiny-admin-api-serve/setting"
+)
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	// Send 发送纯文本邮件
+	Send(to, subject, body string) error
+}
+
+// New 根据mail配置创建邮件发送器：smtp使用SMTP服务器发送，log（默认）写入日志文件或控制台，供本地开发使用
+func New(config *setting.MailConfig) (Mailer, error) {
+	if config == nil {
+		return &LogMailer{}, nil
+	}
+	switch config.Type {
+	case "", "log":
+		return &LogMailer{Path: config.LogPath, From: config.From}, nil
+	case "smtp":
+		if config.Host == "" {
+			return nil, errors.New("mail.host is required for smtp mailer")
+		}
+		return &SmtpMailer{
+			Host:     config.Host,
+			Port:     config.Port,
+			Username: config.Username,
+			Password: config.Password,
+			From:     config.From,
+		}, nil
+	default:
+		return nil, errors.New("unsupported mail type: " + config.Type)
+	}
+}
+
+var (
+	defaultMailer Mailer
+	defaultErr    error
+	defaultOnce   sync.Once
+)
+
+// Default 返回按配置创建的全局邮件发送器，首次调用时创建，配置错误时每次都返回该错误
+func Default() (Mailer, error) {
+	defaultOnce.Do(func() {
+		defaultMailer, defaultErr = New(setting.Conf.MailConfig)
+	})
+	return defaultMailer, defaultErr
+}
+
+// Send 使用全局邮件发送器发送邮件
+func Send(to, subject, body string) error {
+	m, err := Default()
+	if err != nil {
+		return err
+	}
+	return m.Send(to, subject, body)
+}
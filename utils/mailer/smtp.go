@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SmtpMailer 通过SMTP服务器发送邮件，服务器支持时自动使用STARTTLS
+type SmtpMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SmtpMailer) Send(to, subject, body string) error {
+	port := m.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Host, port), auth, m.From, []string{to}, buildMessage(m.From, to, subject, body))
+}
+
+// buildMessage 组装UTF-8纯文本邮件
+func buildMessage(from, to, subject, body string) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + to + "\r\n")
+	sb.WriteString("Subject: =?UTF-8?B?" + encodeBase64(subject) + "?=\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	sb.WriteString(wrapLines(encodeBase64(body), 76))
+	return []byte(sb.String())
+}
+
+func encodeBase64(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// wrapLines 按RFC 2045要求将base64内容按行拆分
+func wrapLines(value string, width int) string {
+	var sb strings.Builder
+	for len(value) > width {
+		sb.WriteString(value[:width] + "\r\n")
+		value = value[width:]
+	}
+	sb.WriteString(value)
+	return sb.String()
+}
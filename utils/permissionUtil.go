@@ -0,0 +1,54 @@
+package utils
+
+import "strings"
+
+const (
+	PermissionSeparator = "::" // 权限编码的层级分隔符，如user::password::force-update
+	PermissionWildcard  = "*"  // 通配符，单独使用时匹配全部权限
+)
+
+// MatchPermission 权限模式是否覆盖指定权限
+// 模式按"::"分段逐段比较，"*"匹配任意一段；位于末尾的"*"匹配剩余的一段或多段，
+// 因此"user::*"覆盖"user::remove"和"user::password::force-update"，"*"覆盖全部权限
+func MatchPermission(pattern, permission string) bool {
+	if pattern == permission {
+		return true
+	}
+	patternParts := strings.Split(pattern, PermissionSeparator)
+	permissionParts := strings.Split(permission, PermissionSeparator)
+	for i, part := range patternParts {
+		if i >= len(permissionParts) {
+			return false
+		}
+		if part == PermissionWildcard {
+			if i == len(patternParts)-1 {
+				return true
+			}
+			continue
+		}
+		if part != permissionParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(permissionParts)
+}
+
+// HasPermission 拥有的权限（可包含通配符）中是否有任一覆盖指定权限
+func HasPermission(owned []string, permission string) bool {
+	for _, pattern := range owned {
+		if MatchPermission(pattern, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWildcardPermission 权限编码是否包含通配符
+func IsWildcardPermission(permission string) bool {
+	for _, part := range strings.Split(permission, PermissionSeparator) {
+		if part == PermissionWildcard {
+			return true
+		}
+	}
+	return false
+}
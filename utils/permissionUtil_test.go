@@ -0,0 +1,79 @@
+package utils
+
+import "testing"
+
+func TestMatchPermission(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		permission string
+		want       bool
+	}{
+		{pattern: "user::remove", permission: "user::remove", want: true},
+		{pattern: "user::remove", permission: "user::update", want: false},
+		{pattern: "*", permission: "user::remove", want: true},
+		{pattern: "*", permission: "user::password::force-update", want: true},
+		{pattern: "user::*", permission: "user::remove", want: true},
+		{pattern: "user::*", permission: "user::password::force-update", want: true},
+		{pattern: "user::*", permission: "user", want: false},
+		{pattern: "user::*", permission: "role::remove", want: false},
+		{pattern: "*::query", permission: "user::query", want: true},
+		{pattern: "*::query", permission: "user::remove", want: false},
+		{pattern: "*::query", permission: "user::password::query", want: false},
+		{pattern: "user::*::force-update", permission: "user::password::force-update", want: true},
+		{pattern: "user::*::force-update", permission: "user::password::reset", want: false},
+		{pattern: "user::*::force-update", permission: "user::force-update", want: false},
+		{pattern: "user::password::force-update", permission: "user::password", want: false},
+		{pattern: "user", permission: "user::remove", want: false},
+		{pattern: "user::rem", permission: "user::remove", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.permission, func(t *testing.T) {
+			if got := MatchPermission(tt.pattern, tt.permission); got != tt.want {
+				t.Errorf("MatchPermission(%q, %q) = %v, want %v", tt.pattern, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		owned      []string
+		permission string
+		want       bool
+	}{
+		{name: "exact", owned: []string{"role::query", "user::remove"}, permission: "user::remove", want: true},
+		{name: "wildcard", owned: []string{"role::query", "user::*"}, permission: "user::remove", want: true},
+		{name: "all", owned: []string{"*"}, permission: "dept::remove", want: true},
+		{name: "not covered", owned: []string{"role::*", "user::query"}, permission: "user::remove", want: false},
+		{name: "empty", owned: []string{}, permission: "user::query", want: false},
+		{name: "nil", owned: nil, permission: "user::query", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.owned, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%v, %q) = %v, want %v", tt.owned, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWildcardPermission(t *testing.T) {
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{permission: "*", want: true},
+		{permission: "user::*", want: true},
+		{permission: "*::query", want: true},
+		{permission: "user::query", want: false},
+		{permission: "user::query*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			if got := IsWildcardPermission(tt.permission); got != tt.want {
+				t.Errorf("IsWildcardPermission(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
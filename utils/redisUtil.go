@@ -18,17 +18,8 @@ type RedisUtil struct {
 // Redis  全局变量, 外部使用utils.Redis来访问
 var Redis RedisUtil
 
-// 初始化redis
-func init() {
-	viper.SetConfigFile("./config/config.yaml")
-
-	err := viper.ReadInConfig() // 读取配置信息
-	if err != nil {
-		// 读取配置信息失败
-		fmt.Printf("viper.ReadInConfig failed, err:%v\n", err)
-		panic(err)
-		return
-	}
+// InitRedis 按cache.redis配置创建redis客户端，需在setting.Init读取配置后调用
+func InitRedis() {
 	//连接redis
 	r := redis.NewClient(&redis.Options{
 		Addr:        fmt.Sprintf("%s:%d", viper.GetString("cache.redis.host"), viper.GetInt("cache.redis.port")),
@@ -70,6 +61,11 @@ func (rs *RedisUtil) GetStr(ctx context.Context, key string) (string, error) {
 	return val, nil
 }
 
+// GetDel 获取redis中数据（string）并删除，用于一次性令牌
+func (rs *RedisUtil) GetDel(ctx context.Context, key string) (string, error) {
+	return rs.client.GetDel(ctx, key).Result()
+}
+
 // HSet 设置数据到redis中（hash）
 func (rs *RedisUtil) HSet(ctx context.Context, key string, field string, value string) error {
 	return rs.client.Do(ctx, "HSet", key, field, value).Err()
@@ -84,15 +80,64 @@ func (rs *RedisUtil) HGet(ctx context.Context, key string, field string) (string
 	return string(val.([]byte)), nil
 }
 
+// HSetAll 设置多个字段到redis中（hash），并设置过期时间
+func (rs *RedisUtil) HSetAll(ctx context.Context, key string, values map[string]interface{}, expiration time.Duration) error {
+	pipe := rs.client.TxPipeline()
+	pipe.HSet(ctx, key, values)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// HGetAll 获取redis中hash的全部字段
+func (rs *RedisUtil) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return rs.client.HGetAll(ctx, key).Result()
+}
+
+// SAdd 添加成员到redis集合中（set）
+func (rs *RedisUtil) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return rs.client.SAdd(ctx, key, members...).Err()
+}
+
+// SMembers 获取redis集合的全部成员（set）
+func (rs *RedisUtil) SMembers(ctx context.Context, key string) ([]string, error) {
+	return rs.client.SMembers(ctx, key).Result()
+}
+
+// SRem 从redis集合中移除成员（set）
+func (rs *RedisUtil) SRem(ctx context.Context, key string, members ...interface{}) error {
+	return rs.client.SRem(ctx, key, members...).Err()
+}
+
 // DelByKey 删除
 func (rs *RedisUtil) DelByKey(ctx context.Context, key string) error {
 	return rs.client.Del(ctx, "DEL", key).Err()
 
 }
 
+// incrWithExpireScript 自增并在key没有过期时间时设置过期时间，两步在Redis中原子执行，
+// 避免自增后设置过期时间前进程退出或请求失败，留下永不过期的计数器
+var incrWithExpireScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// IncrWithExpire 计数器自增，首次创建时设置过期时间，返回自增后的值
+func (rs *RedisUtil) IncrWithExpire(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	return incrWithExpireScript.Run(ctx, rs.client, []string{key}, expiration.Milliseconds()).Int64()
+}
+
+// TTL 获取key的剩余过期时间
+func (rs *RedisUtil) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return rs.client.TTL(ctx, key).Result()
+}
+
 // SetExpire 设置key过期时间
 func (rs *RedisUtil) SetExpire(ctx context.Context, key string, expiration time.Duration) error {
-	return rs.client.Do(ctx, "EXPIRE", key, expiration).Err()
+	return rs.client.Expire(ctx, key, expiration).Err()
 }
 
 // Exists 判断KEY在redis中是否存在
@@ -169,3 +214,29 @@ func (rs *RedisUtil) LeftPushJSON(key string, value interface{}) {
 	}
 
 }
+
+// Publish 发布消息到频道
+func (rs *RedisUtil) Publish(ctx context.Context, channel string, message interface{}) error {
+	return rs.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe 订阅频道并逐条处理消息，阻塞直到ctx取消，连接断开时由客户端自动重连
+func (rs *RedisUtil) Subscribe(ctx context.Context, channel string, handler func(payload string)) error {
+	pubsub := rs.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler(message.Payload)
+		}
+	}
+}
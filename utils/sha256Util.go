@@ -5,11 +5,27 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
 
+// argon2id 参数（参考OWASP推荐值）
+const (
+	argon2Memory  uint32 = 19 * 1024 // 内存消耗（KiB）
+	argon2Time    uint32 = 2         // 迭代次数
+	argon2Threads uint8  = 1         // 并行度
+	argon2KeyLen  uint32 = 32        // 输出长度（字节）
+	argon2SaltLen        = 16        // 盐值长度（字节）
+
+	argon2MaxMemory uint32 = 1024 * 1024 // 校验时接受的最大内存消耗（KiB），避免构造的哈希耗尽内存
+)
+
 // Encry 使用 PBKDF2 算法进行加密
+// 旧版密码格式，仅用于校验历史密码，新密码请使用 HashPassword
 func Encry(value, salt string) (string, error) {
 	// 定义 PBKDF2 的参数
 	iterations := 1000 // 迭代次数
@@ -22,6 +38,20 @@ func Encry(value, salt string) (string, error) {
 	return base64.StdEncoding.EncodeToString(hashedPassword), nil
 }
 
+// HashPassword 使用 argon2id 生成带版本信息的密码哈希，盐值包含在哈希中
+// 格式：$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
 // GenerateSalt 生成随机盐值
 func GenerateSalt() (string, error) {
 	salt := make([]byte, 16)
@@ -33,7 +63,12 @@ func GenerateSalt() (string, error) {
 }
 
 // VerifyPassword 验证密码是否匹配
+// 同时支持 argon2id 格式和旧版 PBKDF2 格式（使用单独保存的salt）
 func VerifyPassword(password, salt, hash string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(password, hash)
+	}
+
 	computedHash, err := Encry(password, salt)
 	if err != nil {
 		return false, err
@@ -41,3 +76,66 @@ func VerifyPassword(password, salt, hash string) (bool, error) {
 	// 使用 subtle.ConstantTimeCompare 进行安全比较
 	return subtle.ConstantTimeCompare([]byte(computedHash), []byte(hash)) == 1, nil
 }
+
+// NeedsRehash 密码哈希是否为旧格式或参数低于当前配置，需要在登录成功后重新计算
+func NeedsRehash(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory < argon2Memory || params.time < argon2Time || params.threads < argon2Threads
+}
+
+// argon2Params argon2id 哈希参数
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// verifyArgon2id 按哈希中记录的参数重新计算并比较
+func verifyArgon2id(password, hash string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+// parseArgon2id 解析 $argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, err
+	}
+	// argon2要求内存不少于8*并行度KiB，参数不合法时argon2.IDKey会panic
+	if params.time < 1 || params.threads < 1 || params.memory < 8*uint32(params.threads) || params.memory > argon2MaxMemory {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if len(salt) == 0 || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+	return params, salt, key, nil
+}
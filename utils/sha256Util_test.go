@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("HashPassword() = %s, want argon2id with current parameters", hash)
+	}
+	// 每次使用随机盐值
+	other, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if hash == other {
+		t.Error("HashPassword() returned the same hash twice")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon2Hash, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	// 旧版PBKDF2-SHA256（1000次迭代，18字节）的独立计算结果
+	const legacySalt = "c2FsdHNhbHRzYWx0"
+	const legacyHash = "VNdUprhcDXuNrIe7QjDfKFO6"
+
+	tests := []struct {
+		name     string
+		password string
+		salt     string
+		hash     string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "argon2id match", password: "Passw0rd!", hash: argon2Hash, want: true},
+		{name: "argon2id mismatch", password: "passw0rd!", hash: argon2Hash, want: false},
+		{name: "argon2id ignores salt column", password: "Passw0rd!", salt: "unused", hash: argon2Hash, want: true},
+		{name: "legacy match", password: "Passw0rd!", salt: legacySalt, hash: legacyHash, want: true},
+		{name: "legacy mismatch", password: "Passw0rd?", salt: legacySalt, hash: legacyHash, want: false},
+		{name: "legacy wrong salt", password: "Passw0rd!", salt: "other", hash: legacyHash, want: false},
+		{name: "malformed argon2id", password: "Passw0rd!", hash: "$argon2id$v=19$m=19456", wantErr: true},
+		{name: "unsupported argon2 version", password: "Passw0rd!", hash: strings.Replace(argon2Hash, "v=19", "v=16", 1), wantErr: true},
+		{name: "empty salt", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 4, ""), wantErr: true},
+		{name: "empty key", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 5, ""), wantErr: true},
+		{name: "zero threads", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 3, "m=19456,t=2,p=0"), wantErr: true},
+		{name: "zero iterations", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 3, "m=19456,t=0,p=1"), wantErr: true},
+		{name: "memory below minimum", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 3, "m=7,t=2,p=1"), wantErr: true},
+		{name: "memory too large", password: "Passw0rd!", hash: withArgon2Part(argon2Hash, 3, "m=4194304,t=2,p=1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPassword(tt.password, tt.salt, tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// withArgon2Part 替换argon2id哈希中按"$"分隔的第index段
+func withArgon2Part(hash string, index int, value string) string {
+	parts := strings.Split(hash, "$")
+	parts[index] = value
+	return strings.Join(parts, "$")
+}
+
+func TestEncry(t *testing.T) {
+	got, err := Encry("Passw0rd!", "c2FsdHNhbHRzYWx0")
+	if err != nil {
+		t.Fatalf("Encry() error = %v", err)
+	}
+	if want := "VNdUprhcDXuNrIe7QjDfKFO6"; got != want {
+		t.Errorf("Encry() = %s, want %s", got, want)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "current parameters", hash: current, want: false},
+		{name: "stronger parameters", hash: strings.Replace(current, "m=19456,t=2,p=1", "m=65536,t=3,p=4", 1), want: false},
+		{name: "lower memory", hash: strings.Replace(current, "m=19456", "m=4096", 1), want: true},
+		{name: "fewer iterations", hash: strings.Replace(current, "t=2", "t=1", 1), want: true},
+		{name: "legacy pbkdf2", hash: "VNdUprhcDXuNrIe7QjDfKFO6", want: true},
+		{name: "empty", hash: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
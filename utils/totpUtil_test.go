@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录B中SHA1测试向量的密钥"12345678901234567890"的base32编码
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 给出的是8位验证码，这里取末6位与totpDigits一致
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := TotpCode(rfc6238Secret, time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatalf("TotpCode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("TotpCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		want   bool
+	}{
+		{name: "current step", secret: rfc6238Secret, code: "050471", at: now, want: true},
+		{name: "lowercase secret with spaces", secret: " gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", code: "050471", at: now, want: true},
+		{name: "previous step", secret: rfc6238Secret, code: "050471", at: now.Add(totpPeriod * time.Second), want: true},
+		{name: "next step", secret: rfc6238Secret, code: "050471", at: now.Add(-totpPeriod * time.Second), want: true},
+		{name: "outside skew", secret: rfc6238Secret, code: "050471", at: now.Add(2 * totpPeriod * time.Second), want: false},
+		{name: "wrong code", secret: rfc6238Secret, code: "123456", at: now, want: false},
+		{name: "8 digit code", secret: rfc6238Secret, code: "14050471", at: now, want: false},
+		{name: "empty code", secret: rfc6238Secret, code: "", at: now, want: false},
+		{name: "invalid secret", secret: "not base32!", code: "050471", at: now, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyTotp(tt.secret, tt.code, tt.at); got != tt.want {
+				t.Errorf("VerifyTotp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}